@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	migrate "github.com/blutspende/cassandra-migrate"
+	"github.com/urfave/cli/v2"
+	"io"
+	"os"
+	"strings"
+)
+
+// yesFlag approves actions in a protected environment without a prompt. Its
+// value must be the environment name, so it cannot be reused by accident.
+var yesFlag = &cli.StringFlag{Name: "yes", Usage: "confirm actions in a protected environment by passing its name"}
+
+// confirmAction returns the Config.Confirm of the up and down commands. It
+// accepts --yes with the environment name, and otherwise prints the plan to
+// stderr and asks for the environment name on an interactive stdin.
+func confirmAction(c *cli.Context) func(request migrate.ConfirmationRequest) error {
+	return func(request migrate.ConfirmationRequest) error {
+		if yes := c.String(yesFlag.Name); yes != "" {
+			if yes != request.Environment {
+				return fmt.Errorf("--yes %s does not match the protected environment %s: %w", yes, request.Environment, migrate.ErrNotConfirmed)
+			}
+			return nil
+		}
+		if !isTerminal(os.Stdin) {
+			return fmt.Errorf("environment %s is protected: run interactively or pass --yes %s: %w", request.Environment, request.Environment, migrate.ErrConfirmationRequired)
+		}
+		printPlan(os.Stderr, request)
+		fmt.Fprintf(os.Stderr, "Type %q to continue: ", request.Environment)
+		answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if strings.TrimSpace(answer) != request.Environment {
+			return fmt.Errorf("environment %s: %w", request.Environment, migrate.ErrNotConfirmed)
+		}
+		return nil
+	}
+}
+
+func printPlan(w io.Writer, request migrate.ConfirmationRequest) {
+	fmt.Fprintf(w, "Environment %s is protected. About to run %s for %d migrations:\n", request.Environment, request.Direction, len(request.Migrations))
+	for _, migration := range request.Migrations {
+		fmt.Fprintf(w, "\n  %s", migration.ID)
+		if migration.Reason != "" {
+			fmt.Fprintf(w, " (%s)", migration.Reason)
+		}
+		fmt.Fprintln(w)
+		for _, statement := range migration.Statements {
+			for _, line := range strings.Split(strings.TrimSpace(statement), "\n") {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	migrate "github.com/blutspende/cassandra-migrate"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// commandResult is the result of one command. It is printed as text or
+// embedded in a commandOutput document.
+type commandResult interface {
+	text() string
+}
+
+// commandOutput is the document printed with --output json. Fields are only
+// ever added, never renamed or removed, so pipelines can rely on them.
+type commandOutput struct {
+	Command     string        `json:"command"`
+	Environment string        `json:"environment"`
+	Success     bool          `json:"success"`
+	Result      commandResult `json:"result,omitempty"`
+	Error       *errorOutput  `json:"error,omitempty"`
+}
+
+type errorOutput struct {
+	Message        string `json:"message"`
+	MigrationID    string `json:"migration_id,omitempty"`
+	StatementIndex *int   `json:"statement_index,omitempty"`
+	Statement      string `json:"statement,omitempty"`
+}
+
+type migrationOutput struct {
+	ID         string  `json:"id"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+type upOutput struct {
+	AppliedCount        int                 `json:"applied_count"`
+	PendingCount        int                 `json:"pending_count"`
+	AppliedMigrationIDs []string            `json:"applied_migration_ids"`
+	Migrations          []migrationOutput   `json:"migrations"`
+	OutOfOrder          []string            `json:"out_of_order_migration_ids"`
+	Repeatable          []migrationOutput   `json:"repeatable"`
+	Skipped             []string            `json:"skipped_migration_ids"`
+	Compensation        *compensationOutput `json:"compensation"`
+}
+
+type compensatedStatementOutput struct {
+	Index     int    `json:"statement_index"`
+	Statement string `json:"statement"`
+	Undo      string `json:"undo,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// compensationOutput reports the undone statements of a failed migration,
+// see migrate.Compensation.
+type compensationOutput struct {
+	MigrationID string                       `json:"migration_id"`
+	Complete    bool                         `json:"complete"`
+	Undone      []compensatedStatementOutput `json:"undone"`
+	Remaining   []compensatedStatementOutput `json:"remaining"`
+}
+
+func newCompensationOutput(compensation *migrate.Compensation) *compensationOutput {
+	if compensation == nil {
+		return nil
+	}
+	output := &compensationOutput{
+		MigrationID: compensation.MigrationID,
+		Complete:    compensation.Complete(),
+		Undone:      make([]compensatedStatementOutput, 0, len(compensation.Undone)),
+		Remaining:   make([]compensatedStatementOutput, 0, len(compensation.Remaining)),
+	}
+	for _, statement := range compensation.Undone {
+		output.Undone = append(output.Undone, compensatedStatementOutput{Index: statement.Index, Statement: statement.Statement, Undo: statement.Undo})
+	}
+	for _, statement := range compensation.Remaining {
+		output.Remaining = append(output.Remaining, compensatedStatementOutput{Index: statement.Index, Statement: statement.Statement, Undo: statement.Undo, Error: statement.Err.Error()})
+	}
+
+	return output
+}
+
+func (o compensationOutput) text() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Compensated %s: undid %d statements, %d remain applied\n", o.MigrationID, len(o.Undone), len(o.Remaining))
+	for _, statement := range o.Undone {
+		fmt.Fprintf(&out, "  undone     #%d %s\n", statement.Index, strings.TrimSpace(statement.Statement))
+	}
+	for _, statement := range o.Remaining {
+		fmt.Fprintf(&out, "  NOT UNDONE #%d %s: %s\n", statement.Index, strings.TrimSpace(statement.Statement), statement.Error)
+	}
+
+	return out.String()
+}
+
+func newUpOutput(result migrate.UpResult) upOutput {
+	output := upOutput{
+		AppliedCount:        result.AppliedCount,
+		PendingCount:        result.PendingCount,
+		AppliedMigrationIDs: result.AppliedMigrationIDs,
+		Migrations:          newMigrationOutputs(result.Migrations),
+		OutOfOrder:          result.OutOfOrderMigrationIDs,
+		Repeatable:          newMigrationOutputs(result.Repeatable),
+		Skipped:             result.SkippedMigrationIDs,
+		Compensation:        newCompensationOutput(result.Compensation),
+	}
+	if output.Skipped == nil {
+		output.Skipped = make([]string, 0)
+	}
+	if output.AppliedMigrationIDs == nil {
+		output.AppliedMigrationIDs = make([]string, 0)
+	}
+	if output.OutOfOrder == nil {
+		output.OutOfOrder = make([]string, 0)
+	}
+
+	return output
+}
+
+func newMigrationOutputs(migrations []migrate.MigrationResult) []migrationOutput {
+	outputs := make([]migrationOutput, 0, len(migrations))
+	for _, migration := range migrations {
+		outputs = append(outputs, migrationOutput{
+			ID:         migration.ID,
+			DurationMS: milliseconds(migration.Duration),
+		})
+	}
+
+	return outputs
+}
+
+// printOutOfOrder lists the out of order migrations of an up run in text
+// output before anything is applied. JSON output has them in
+// out_of_order_migration_ids.
+func printOutOfOrder(migrationIDs []string) {
+	fmt.Printf("Out of order migrations (%d):\n", len(migrationIDs))
+	for _, id := range migrationIDs {
+		fmt.Printf("  %s\n", id)
+	}
+}
+
+func (o upOutput) text() string {
+	out := fmt.Sprintf("Applied %d of %d migrations\n", o.AppliedCount, o.PendingCount)
+	if len(o.Repeatable) > 0 {
+		out = fmt.Sprintf("Applied %d of %d migrations and %d repeatable migrations\n", o.AppliedCount, o.PendingCount, len(o.Repeatable))
+	}
+	if o.Compensation != nil {
+		out += o.Compensation.text()
+	}
+
+	return out
+}
+
+type appliedMigrationOutput struct {
+	ID        string    `json:"id"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+type statusOutput struct {
+	Applied    []appliedMigrationOutput `json:"applied"`
+	Pending    []string                 `json:"pending"`
+	OutOfOrder []string                 `json:"out_of_order"`
+	Repeatable []string                 `json:"pending_repeatable"`
+	Skipped    []string                 `json:"skipped"`
+}
+
+func newStatusOutput(status migrate.Status) statusOutput {
+	output := statusOutput{
+		Applied:    make([]appliedMigrationOutput, 0, len(status.Applied)),
+		Pending:    status.Pending,
+		OutOfOrder: status.OutOfOrder,
+		Repeatable: status.PendingRepeatable,
+		Skipped:    status.Skipped,
+	}
+	for _, migration := range status.Applied {
+		output.Applied = append(output.Applied, appliedMigrationOutput{ID: migration.ID, AppliedAt: migration.AppliedAt.UTC()})
+	}
+
+	return output
+}
+
+func (o statusOutput) text() string {
+	var out strings.Builder
+	outOfOrder := make(map[string]bool, len(o.OutOfOrder))
+	for _, id := range o.OutOfOrder {
+		outOfOrder[id] = true
+	}
+	skipped := make(map[string]bool, len(o.Skipped))
+	for _, id := range o.Skipped {
+		skipped[id] = true
+	}
+	for _, migration := range o.Applied {
+		if skipped[migration.ID] {
+			fmt.Fprintf(&out, "applied  %s  %s  skipped\n", migration.ID, migration.AppliedAt.Format(time.RFC3339))
+			continue
+		}
+		fmt.Fprintf(&out, "applied  %s  %s\n", migration.ID, migration.AppliedAt.Format(time.RFC3339))
+	}
+	for _, id := range o.Pending {
+		switch {
+		case outOfOrder[id]:
+			fmt.Fprintf(&out, "pending  %s  out of order\n", id)
+		case skipped[id]:
+			fmt.Fprintf(&out, "pending  %s  skipped\n", id)
+		default:
+			fmt.Fprintf(&out, "pending  %s\n", id)
+		}
+	}
+	for _, id := range o.Repeatable {
+		fmt.Fprintf(&out, "pending  %s  repeatable\n", id)
+	}
+	fmt.Fprintf(&out, "%d applied, %d pending, %d out of order, %d repeatable pending\n", len(o.Applied), len(o.Pending), len(o.OutOfOrder), len(o.Repeatable))
+
+	return out.String()
+}
+
+type downOutput struct {
+	Applied     bool    `json:"applied"`
+	MigrationID string  `json:"migration_id,omitempty"`
+	DurationMS  float64 `json:"duration_ms"`
+	failed      bool
+}
+
+func newDownOutput(result migrate.DownResult, err error) downOutput {
+	return downOutput{
+		Applied:     result.Applied,
+		MigrationID: result.MigrationID,
+		DurationMS:  milliseconds(result.Duration),
+		failed:      err != nil,
+	}
+}
+
+func (o downOutput) text() string {
+	switch {
+	case o.Applied:
+		return fmt.Sprintf("Applied down migration %s\n", o.MigrationID)
+	case o.MigrationID != "":
+		return fmt.Sprintf("Down migration %s not applied\n", o.MigrationID)
+	case o.failed:
+		return ""
+	default:
+		return "No migrations to apply\n"
+	}
+}
+
+type newOutput struct {
+	Path string `json:"path"`
+}
+
+func (o newOutput) text() string {
+	return fmt.Sprintf("Created migration %s\n", o.Path)
+}
+
+type squashOutput struct {
+	BaselineID   string   `json:"baseline_id"`
+	BaselinePath string   `json:"baseline_path"`
+	Covers       []string `json:"covers"`
+	ArchiveDir   string   `json:"archive_dir"`
+}
+
+func (o squashOutput) text() string {
+	return fmt.Sprintf("Squashed %d migrations into %s, originals moved to %s\n", len(o.Covers), o.BaselinePath, o.ArchiveDir)
+}
+
+type simulationErrorOutput struct {
+	MigrationID string `json:"migration_id"`
+	Direction   string `json:"direction"`
+	Line        int    `json:"line"`
+	Statement   string `json:"statement"`
+	Message     string `json:"message"`
+}
+
+type simulateOutput struct {
+	MigrationIDs []string                `json:"migration_ids"`
+	Errors       []simulationErrorOutput `json:"errors"`
+	Schema       string                  `json:"schema"`
+}
+
+func newSimulateOutput(result migrate.SimulationResult) simulateOutput {
+	output := simulateOutput{
+		MigrationIDs: result.MigrationIDs,
+		Errors:       make([]simulationErrorOutput, 0, len(result.Errors)),
+		Schema:       result.Schema.CQL(),
+	}
+	for _, err := range result.Errors {
+		output.Errors = append(output.Errors, simulationErrorOutput{
+			MigrationID: err.MigrationID,
+			Direction:   string(err.Direction),
+			Line:        err.Line,
+			Statement:   err.Statement,
+			Message:     err.Err.Error(),
+		})
+	}
+
+	return output
+}
+
+func (o simulateOutput) text() string {
+	var out strings.Builder
+	for _, err := range o.Errors {
+		fmt.Fprintf(&out, "%s:%d: %s: %s\n", err.MigrationID, err.Line, err.Direction, err.Message)
+	}
+	fmt.Fprintf(&out, "Simulated %d migrations, %d failing statements\n", len(o.MigrationIDs), len(o.Errors))
+
+	return out.String()
+}
+
+type roundTripMigrationOutput struct {
+	ID          string   `json:"id"`
+	OK          bool     `json:"ok"`
+	Differences []string `json:"differences"`
+	Error       string   `json:"error,omitempty"`
+}
+
+type roundTripOutput struct {
+	Migrations []roundTripMigrationOutput `json:"migrations"`
+}
+
+func newRoundTripOutput(result migrate.RoundTripResult) roundTripOutput {
+	output := roundTripOutput{Migrations: make([]roundTripMigrationOutput, 0, len(result.Migrations))}
+	for _, migration := range result.Migrations {
+		verified := roundTripMigrationOutput{ID: migration.ID, OK: migration.OK(), Differences: migration.Differences}
+		if verified.Differences == nil {
+			verified.Differences = []string{}
+		}
+		if migration.Err != nil {
+			verified.Error = migration.Err.Error()
+		}
+		output.Migrations = append(output.Migrations, verified)
+	}
+
+	return output
+}
+
+func (o roundTripOutput) text() string {
+	var out strings.Builder
+	failed := 0
+	for _, migration := range o.Migrations {
+		if migration.OK {
+			fmt.Fprintf(&out, "ok    %s\n", migration.ID)
+			continue
+		}
+		failed++
+		fmt.Fprintf(&out, "FAIL  %s\n", migration.ID)
+		if migration.Error != "" {
+			fmt.Fprintf(&out, "      %s\n", migration.Error)
+		}
+		for _, difference := range migration.Differences {
+			fmt.Fprintf(&out, "      %s\n", difference)
+		}
+	}
+	fmt.Fprintf(&out, "Verified %d migrations, %d do not reverse their Up in Down\n", len(o.Migrations), failed)
+
+	return out.String()
+}
+
+type testRunOutput struct {
+	Keyspace            string   `json:"keyspace"`
+	AppliedMigrationIDs []string `json:"applied_migration_ids"`
+	Command             []string `json:"command"`
+	ExitCode            int      `json:"exit_code"`
+}
+
+func newTestRunOutput(scratch migrate.ScratchKeyspace, command []string) *testRunOutput {
+	output := &testRunOutput{
+		Keyspace:            scratch.Name,
+		AppliedMigrationIDs: scratch.Up.AppliedMigrationIDs,
+		Command:             command,
+	}
+	if output.AppliedMigrationIDs == nil {
+		output.AppliedMigrationIDs = make([]string, 0)
+	}
+	if output.Command == nil {
+		output.Command = make([]string, 0)
+	}
+
+	return output
+}
+
+func (o testRunOutput) text() string {
+	out := fmt.Sprintf("Applied %d migrations to scratch keyspace %s\n", len(o.AppliedMigrationIDs), o.Keyspace)
+	if len(o.Command) > 0 {
+		out += fmt.Sprintf("%s exited with code %d\n", strings.Join(o.Command, " "), o.ExitCode)
+	}
+
+	return out
+}
+
+type historyEntryOutput struct {
+	MigrationID string  `json:"migration_id"`
+	Action      string  `json:"action"`
+	RecordedAt  string  `json:"recorded_at"`
+	User        string  `json:"user"`
+	Host        string  `json:"host"`
+	Checksum    string  `json:"checksum"`
+	DurationMS  float64 `json:"duration_ms"`
+	Outcome     string  `json:"outcome"`
+	Error       string  `json:"error,omitempty"`
+}
+
+type historyOutput struct {
+	Entries []historyEntryOutput `json:"entries"`
+}
+
+func newHistoryOutput(entries []migrate.HistoryEntry) historyOutput {
+	output := historyOutput{Entries: make([]historyEntryOutput, 0, len(entries))}
+	for _, entry := range entries {
+		output.Entries = append(output.Entries, historyEntryOutput{
+			MigrationID: entry.MigrationID,
+			Action:      string(entry.Action),
+			RecordedAt:  entry.RecordedAt.UTC().Format(time.RFC3339Nano),
+			User:        entry.User,
+			Host:        entry.Host,
+			Checksum:    entry.Checksum,
+			DurationMS:  milliseconds(entry.Duration),
+			Outcome:     entry.Outcome,
+			Error:       entry.Error,
+		})
+	}
+
+	return output
+}
+
+func (o historyOutput) text() string {
+	if len(o.Entries) == 0 {
+		return "No recorded history\n"
+	}
+	var out strings.Builder
+	for _, entry := range o.Entries {
+		fmt.Fprintf(&out, "%s  %-8s  %-9s  %s  %s@%s  %.0fms", entry.RecordedAt, entry.Action, entry.Outcome, entry.MigrationID, entry.User, entry.Host, entry.DurationMS)
+		if entry.Error != "" {
+			fmt.Fprintf(&out, "  %s", entry.Error)
+		}
+		out.WriteString("\n")
+	}
+
+	return out.String()
+}
+
+// configOutput is the redacted config of one environment, printed as YAML in
+// text mode and as the equivalent JSON object otherwise.
+type configOutput struct {
+	environment string
+	config      migrate.Config
+}
+
+func (o configOutput) text() string {
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]migrate.Config{o.environment: o.config}); err != nil {
+		return err.Error() + "\n"
+	}
+	if err := encoder.Close(); err != nil {
+		return err.Error() + "\n"
+	}
+	return out.String()
+}
+
+func (o configOutput) MarshalJSON() ([]byte, error) {
+	out, err := yaml.Marshal(o.config)
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]any)
+	if err := yaml.Unmarshal(out, &settings); err != nil {
+		return nil, err
+	}
+	return json.Marshal(settings)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// runCommand wraps a command action and prints its result in the format
+// selected with --output. A failed command still prints its partial result
+// and returns the error, so the process exits non-zero.
+func runCommand(name string, opts *cliOptions, action func(c *cli.Context) (commandResult, error)) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		// --output after the command takes precedence over the global flag
+		if c.IsSet("output") {
+			opts.Output = c.String("output")
+		}
+		if opts.Output != outputText && opts.Output != outputJSON {
+			return fmt.Errorf("invalid output %q: must be text or json", opts.Output)
+		}
+		result, err := action(c)
+		if opts.Output == outputText {
+			if result != nil {
+				fmt.Print(result.text())
+			}
+			return err
+		}
+
+		output := commandOutput{
+			Command:     name,
+			Environment: opts.Environment,
+			Success:     err == nil,
+			Result:      result,
+		}
+		if err != nil {
+			output.Error = newErrorOutput(err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(output); encodeErr != nil {
+			return errors.Join(err, encodeErr)
+		}
+
+		return err
+	}
+}
+
+func newErrorOutput(err error) *errorOutput {
+	output := &errorOutput{Message: err.Error()}
+	var migrationErr *migrate.MigrationError
+	if errors.As(err, &migrationErr) {
+		output.MigrationID = migrationErr.MigrationID
+	}
+	var statementErr *migrate.StatementError
+	if errors.As(err, &statementErr) {
+		output.StatementIndex = &statementErr.Index
+		output.Statement = statementErr.Statement
+	}
+
+	return output
+}
@@ -1,55 +1,99 @@
 package migrate
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	gocql "github.com/apache/cassandra-gocql-driver/v2"
 )
 
-// GetConnection creates a Cassandra session using password authentication.
-func GetConnection(hosts []string, port int, keyspace, username, password string) (*gocql.Session, error) {
-	if username == DefaultConfigUsername && password == DefaultConfigPassword {
-		println("warning, using default credentials")
-	}
-	cluster := gocql.NewCluster(hosts...)
-	cluster.Port = port
-	cluster.Keyspace = keyspace
-	cluster.ProtoVersion = 5
-	cluster.Authenticator = gocql.PasswordAuthenticator{
-		Username: username,
-		Password: password,
-	}
-
-	return cluster.CreateSession()
-}
-
 // IsExistError reports whether the given error is a Cassandra "already exists" error.
 func IsExistError(err error) bool {
 	var requestErr gocql.RequestError
 	return errors.As(err, &requestErr) && requestErr.Code() == gocql.ErrCodeAlreadyExists
 }
 
+// isMissingTableError reports whether err is the error Cassandra returns for a
+// query on a table that does not exist, e.g. "unconfigured table users".
+func isMissingTableError(err error) bool {
+	var requestErr gocql.RequestError
+	if !errors.As(err, &requestErr) || requestErr.Code() != gocql.ErrCodeInvalid {
+		return false
+	}
+	message := strings.ToLower(requestErr.Message())
+	return strings.Contains(message, "unconfigured table") ||
+		strings.Contains(message, "table") && strings.Contains(message, "does not exist")
+}
+
+// MigrationError is returned by ApplyUp and ApplyDown when a migration fails.
+type MigrationError struct {
+	MigrationID string
+	Err         error
+}
+
+func (e *MigrationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// StatementError wraps the error of a single failed migration statement.
+type StatementError struct {
+	// Index is the zero based position of the statement in its migration section.
+	Index     int
+	Statement string
+	Err       error
+	// Applied holds the indexes of the earlier statements of the section that
+	// took effect, without those whose "already exists" error was ignored.
+	Applied []int
+}
+
+func (e *StatementError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
 // Migration represents one applied migration row from the tracking table.
 type Migration struct {
 	ID        string
 	AppliedAt time.Time
 }
 
-// IsNewerMigration orders applied migrations by timestamp descending, then ID descending.
+// IsNewerMigration orders applied migrations by timestamp descending, then
+// version descending.
 func IsNewerMigration(left, right Migration) bool {
 	if left.AppliedAt.Equal(right.AppliedAt) {
-		return left.ID > right.ID
+		return CompareMigrationIDs(left.ID, right.ID) > 0
 	}
 	return left.AppliedAt.After(right.AppliedAt)
 }
 
-// GetExistingMigrations returns all applied migrations for a keyspace.
+const selectMigrationsQueryTemplate = `SELECT id, applied_at FROM %s;`
+
+// GetExistingMigrations returns all applied migrations for a keyspace that
+// uses the default tracking table.
 func GetExistingMigrations(keyspace string, session *gocql.Session) ([]Migration, error) {
-	query := fmt.Sprintf(`SELECT id, applied_at FROM "%s_migrations";`, keyspace)
+	return GetExistingMigrationsInTable(Config{Keyspace: keyspace}.TrackingTable(), session)
+}
+
+// GetExistingMigrationsInTable returns all applied migrations recorded in the
+// given tracking table, as returned by Config.TrackingTable.
+func GetExistingMigrationsInTable(table string, session *gocql.Session) ([]Migration, error) {
+	return existingMigrations(context.Background(), NewSession(session), table)
+}
+
+func existingMigrations(ctx context.Context, session Session, table string) ([]Migration, error) {
+	query := fmt.Sprintf(selectMigrationsQueryTemplate, table)
 	appliedMigrations := make([]Migration, 0)
-	iter := session.Query(query).Iter()
+	iter := session.Iter(ctx, query)
 	for {
 		var migration Migration
 		if !iter.Scan(&migration.ID, &migration.AppliedAt) {
@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/blutspende/cassandra-migrate/sqlparse"
+)
+
+// ErrNoUndo is the error of an applied statement without an undo statement.
+var ErrNoUndo = errors.New("not compensated: no '-- +migrate Undo' or matching Down statement")
+
+// Compensation reports how ApplyUp undid the applied statements of a
+// migration whose Up section failed halfway, when Config.Compensate is set.
+type Compensation struct {
+	MigrationID string
+	// Undone holds the statements that were undone, latest first.
+	Undone []CompensatedStatement
+	// Remaining holds the statements that are still in effect, latest first,
+	// with the reason in Err.
+	Remaining []CompensatedStatement
+}
+
+// Complete reports whether every applied statement was undone, so the
+// migration can be fixed and applied again.
+func (c Compensation) Complete() bool {
+	return len(c.Remaining) == 0
+}
+
+// CompensatedStatement is an applied Up statement of a failed migration.
+type CompensatedStatement struct {
+	// Index is the zero based position of the statement in the Up section.
+	Index     int
+	Statement string
+	// Undo is the statement that reverses it, empty when there is none.
+	Undo string
+	// Err is ErrNoUndo or the error of Undo when the statement is not undone.
+	Err error
+}
+
+// compensate runs the undo statements of the statements applied before
+// failed, latest first. Failing undo statements are reported and skipped.
+func compensate(conf Config, migrationID string, migration *sqlparse.ParsedMigration, failed *StatementError, execQuery queryExecutor) Compensation {
+	statements := migration.UpStatementsFor(conf.Environment)
+	undo := undoStatements(migration, conf.Environment)
+	logger := conf.logger().With("migration", migrationID)
+	compensation := Compensation{
+		MigrationID: migrationID,
+		Undone:      make([]CompensatedStatement, 0, len(failed.Applied)),
+		Remaining:   make([]CompensatedStatement, 0),
+	}
+	for i := len(failed.Applied) - 1; i >= 0; i-- {
+		index := failed.Applied[i]
+		statement := CompensatedStatement{Index: index, Statement: statements[index], Undo: undo[index]}
+		if statement.Undo == "" {
+			statement.Err = ErrNoUndo
+		} else {
+			statement.Err = execQuery(statement.Undo)
+		}
+		if statement.Err != nil {
+			logger.Error("statement not undone", "statement_index", index, "statement", statement.Statement, "error", statement.Err)
+			compensation.Remaining = append(compensation.Remaining, statement)
+			continue
+		}
+		logger.Info("undid statement", "statement_index", index, "undo", statement.Undo)
+		compensation.Undone = append(compensation.Undone, statement)
+	}
+
+	return compensation
+}
+
+// err summarizes the statements that are still in effect for the history.
+func (c Compensation) err() error {
+	if c.Complete() {
+		return nil
+	}
+	return fmt.Errorf("%d of %d applied statements not undone", len(c.Remaining), len(c.Remaining)+len(c.Undone))
+}
+
+// undoStatements maps each Up statement to the statement that reverses it.
+// Undo statements declared in the migration take precedence. With
+// '-- +migrate CompensateWithDown' the remaining Up statements are matched
+// with the Down statements in reverse order, so the last Down statement
+// undoes the first Up statement.
+func undoStatements(migration *sqlparse.ParsedMigration, env string) map[int]string {
+	up, down := migration.UpStatementsFor(env), migration.DownStatementsFor(env)
+	undo := make(map[int]string, len(up))
+	if migration.CompensateWithDown && len(up) == len(down) {
+		for i := range up {
+			undo[i] = down[len(down)-1-i]
+		}
+	}
+	for i, statement := range migration.Undo {
+		undo[i] = statement
+	}
+
+	return undo
+}
@@ -2,8 +2,14 @@ package migrate
 
 import (
 	"errors"
+	"fmt"
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/yaml.v3"
+	"log/slog"
 	"os"
+	"regexp"
 	"strings"
 )
 
@@ -14,29 +20,140 @@ const (
 	DefaultConfigUsername     = "cassandra"
 	DefaultConfigPassword     = "cassandra"
 	DefaultConfigMigrationDir = "migrations"
+
+	DefaultConfigProtocolVersion = "5"
+
+	// DefaultMigrationTableSuffix is appended to the keyspace to form the
+	// tracking table name when no migration_table is configured.
+	DefaultMigrationTableSuffix = "_migrations"
 )
 
+var tableNameRegex = regexp.MustCompile("[^A-Za-z0-9_]+")
+
 // Config represents validated runtime migration settings for one environment.
 type Config struct {
-	Keyspace          string     `yaml:"keyspace"`
-	MigrationDir      string     `yaml:"migration_dir"`
-	Connection        Connection `yaml:"connection"`
-	IgnoreExistErrors bool       `yaml:"-"`
+	Keyspace          string     `yaml:"keyspace,omitempty"`
+	MigrationDir      string     `yaml:"migration_dir,omitempty"`
+	MigrationTable    string     `yaml:"migration_table,omitempty"`
+	MigrationKeyspace string     `yaml:"migration_keyspace,omitempty"`
+	Connection        Connection `yaml:"connection,omitempty"`
+	Development       bool       `yaml:"development,omitempty"`
+	// Protected requires confirmation through Confirm before ApplyDown and
+	// before ApplyUp runs dangerous migrations.
+	Protected bool `yaml:"protected,omitempty"`
+	// Compensate undoes the applied statements of a migration whose Up
+	// section fails halfway, see Compensation.
+	Compensate bool `yaml:"compensate,omitempty"`
+	// OutOfOrder is the policy for pending migrations older than the newest
+	// applied one: allow, warn or fail.
+	OutOfOrder string `yaml:"out_of_order,omitempty"`
+	// Versioning selects the version prefix of new migrations: timestamp,
+	// utc or sequential. With sequential, migration files without a unique
+	// version prefix are rejected instead of logged.
+	Versioning string `yaml:"versioning,omitempty"`
+	// MigrationTemplate is a text/template file used by CreateMigration,
+	// see MigrationTemplateData.
+	MigrationTemplate string     `yaml:"migration_template,omitempty"`
+	ShellHooks        ShellHooks `yaml:"hooks,omitempty"`
+	// Environment is the name of the selected environment, set by
+	// GetConfigWithOptions. Migrations restricted with '-- +migrate Env'
+	// only run in the listed environments, so with an empty Environment, as
+	// for most library callers, every restricted migration is skipped.
+	Environment       string `yaml:"-"`
+	IgnoreExistErrors bool   `yaml:"-"`
+	Hooks             Hooks  `yaml:"-"`
+	// Confirm is asked to approve actions in a Protected environment. A nil
+	// Confirm refuses them with ErrConfirmationRequired.
+	Confirm func(request ConfirmationRequest) error `yaml:"-"`
+	// OutOfOrderFound is called by ApplyUp with the out of order migrations
+	// before the policy in OutOfOrder is applied and before anything runs.
+	OutOfOrderFound func(migrationIDs []string) `yaml:"-"`
+	// Logger receives structured migration events. Nil disables logging.
+	Logger *slog.Logger `yaml:"-"`
+	// TracerProvider and MeterProvider receive OpenTelemetry spans and
+	// metrics. Nil disables the instrumentation.
+	TracerProvider trace.TracerProvider `yaml:"-"`
+	MeterProvider  metric.MeterProvider `yaml:"-"`
+	// Session replaces the connection to Connection.Hosts, e.g. with a
+	// migratetest.Session. It is not closed after a run.
+	Session Session `yaml:"-"`
+}
+
+// TrackingTable returns the quoted name of the migration tracking table. The
+// name is qualified with MigrationKeyspace when one is configured, otherwise
+// the table lives in the migrated keyspace.
+func (c Config) TrackingTable() string {
+	table := c.MigrationTable
+	if table == "" {
+		table = c.Keyspace + DefaultMigrationTableSuffix
+	}
+	if c.MigrationKeyspace == "" {
+		return fmt.Sprintf(`"%s"`, table)
+	}
+	return fmt.Sprintf(`"%s"."%s"`, c.MigrationKeyspace, table)
 }
 
 // Connection describes Cassandra connectivity settings.
 type Connection struct {
-	Hosts    []string `yaml:"hosts"`
-	Port     string   `yaml:"port"`
-	Username string   `yaml:"username"`
-	Password string   `yaml:"password"`
+	Hosts           []string           `yaml:"hosts,omitempty"`
+	Port            string             `yaml:"port,omitempty"`
+	Auth            string             `yaml:"auth,omitempty"`
+	Username        string             `yaml:"username,omitempty"`
+	Password        string             `yaml:"password,omitempty"`
+	PasswordFile    string             `yaml:"password_file,omitempty"`
+	PasswordCommand []string           `yaml:"password_command,omitempty"`
+	TLS             *TLSConfig         `yaml:"tls,omitempty"`
+	Consistency     string             `yaml:"consistency,omitempty"`
+	ConnectTimeout  string             `yaml:"connect_timeout,omitempty"`
+	RequestTimeout  string             `yaml:"request_timeout,omitempty"`
+	ProtocolVersion string             `yaml:"protocol_version,omitempty"`
+	NumConnections  string             `yaml:"num_connections,omitempty"`
+	RetryPolicy     *RetryPolicyConfig `yaml:"retry_policy,omitempty"`
+
+	LocalDC                  string            `yaml:"local_dc,omitempty"`
+	HostSelection            string            `yaml:"host_selection,omitempty"`
+	DisableInitialHostLookup bool              `yaml:"disable_initial_host_lookup,omitempty"`
+	AddressTranslation       map[string]string `yaml:"address_translation,omitempty"`
+
+	// Authenticator overrides the configured authentication for library callers.
+	Authenticator gocql.Authenticator `yaml:"-"`
+}
+
+// TLSConfig describes optional TLS and client certificate settings. A nil
+// TLSConfig disables TLS.
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// RetryPolicyConfig selects the driver retry policy for failed queries.
+type RetryPolicyConfig struct {
+	Type       string `yaml:"type,omitempty"`
+	NumRetries string `yaml:"num_retries,omitempty"`
+	MinBackoff string `yaml:"min_backoff,omitempty"`
+	MaxBackoff string `yaml:"max_backoff,omitempty"`
 }
 
-// Options represents loader options for retrieving a Config from YAML.
+// Options represents loader options for retrieving a Config from YAML,
+// environment variables, a DSN and explicit overrides. Later sources take
+// precedence: config file < environment variables < DSN < Overrides.
 type Options struct {
 	ConfigFile        string
 	Environment       string
 	IgnoreExistErrors bool
+	// Strict rejects unknown YAML keys and unset environment variables
+	// referenced without a default.
+	Strict bool
+	// UseEnv reads settings from CASSANDRA_MIGRATE_* environment variables,
+	// see ConfigSetting.EnvVar.
+	UseEnv bool
+	// DSN is a cassandra:// connection string, see ParseDSN.
+	DSN string
+	// Overrides maps ConfigSetting.Path to a value, as given on the command line.
+	Overrides map[string]string
 }
 
 // DefaultOptions returns default config loader values.
@@ -48,42 +165,101 @@ func DefaultOptions() Options {
 	}
 }
 
-// ReadConfigFile reads and unmarshals the full environment map from a config file.
+// ReadConfigFile reads and unmarshals the full environment map from a config
+// file. The defaults section and extends chains are merged into each
+// environment, and the defaults section itself is not returned.
 func ReadConfigFile(configFile string) (map[string]Config, error) {
+	environments, err := readEnvironments(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]Config, len(environments))
+	for name, settings := range environments {
+		conf, err := decodeEnvironment(settings, false)
+		if err != nil {
+			return nil, fmt.Errorf("environment %s: %w", name, err)
+		}
+		config[name] = conf
+	}
+
+	return config, nil
+}
+
+func readEnvironments(configFile string) (map[string]map[string]any, error) {
 	file, err := os.ReadFile(configFile)
 	if err != nil {
 		return nil, err
 	}
 
-	config := make(map[string]Config)
-	err = yaml.Unmarshal(file, config)
+	var document yaml.Node
+	err = yaml.Unmarshal(file, &document)
 	if err != nil {
 		return nil, err
 	}
+	raw := map[string]any{}
+	if len(document.Content) > 0 {
+		root := resolveAlias(document.Content[0])
+		if root.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: config file must be a mapping of environments", root.Line)
+		}
+		raw, err = nodeSettings(root)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return config, nil
+	return resolveEnvironments(raw)
 }
 
 // GetDefaultConfig loads configuration using default options.
 func GetDefaultConfig() (Config, error) {
-	opts := DefaultOptions()
-	return GetConfigFrom(opts.ConfigFile, opts.Environment, opts.IgnoreExistErrors)
+	return GetConfigWithOptions(DefaultOptions())
 }
 
 // GetConfigFrom loads and validates one environment from the config file.
 func GetConfigFrom(configFile, configEnvironment string, ignoreExistErrors bool) (Config, error) {
-	config, err := ReadConfigFile(configFile)
+	return GetConfigWithOptions(Options{
+		ConfigFile:        configFile,
+		Environment:       configEnvironment,
+		IgnoreExistErrors: ignoreExistErrors,
+	})
+}
+
+// GetConfigWithOptions loads and validates the environment selected by opts.
+// The config file may be missing or empty when the other sources provide
+// settings.
+func GetConfigWithOptions(opts Options) (Config, error) {
+	overrides, err := collectOverrides(opts)
 	if err != nil {
 		return Config{}, err
 	}
-
-	conf, ok := config[configEnvironment]
-	if !ok {
-		return Config{}, errors.New("no environment: " + configEnvironment)
+	settings := map[string]any{}
+	if opts.ConfigFile != "" {
+		environments, err := readEnvironments(opts.ConfigFile)
+		switch {
+		case err == nil:
+			environmentSettings, ok := environments[opts.Environment]
+			if !ok {
+				return Config{}, errors.New("no environment: " + opts.Environment)
+			}
+			settings = environmentSettings
+		case errors.Is(err, os.ErrNotExist) && len(overrides) > 0:
+			// configured entirely through environment variables, DSN or overrides
+		default:
+			return Config{}, err
+		}
+	}
+	conf, err := decodeEnvironment(mergeSettings(settings, overrides), opts.Strict)
+	if err != nil {
+		return Config{}, fmt.Errorf("environment %s: %w", opts.Environment, err)
+	}
+	if err := expandConfig(&conf, opts.Strict); err != nil {
+		return Config{}, err
 	}
 	nonEmptyHosts := make([]string, 0)
 	for _, host := range conf.Connection.Hosts {
-		trimmedHost := strings.TrimSpace(os.ExpandEnv(host))
+		trimmedHost := strings.TrimSpace(host)
 		if trimmedHost != "" {
 			nonEmptyHosts = append(nonEmptyHosts, trimmedHost)
 		}
@@ -95,27 +271,120 @@ func GetConfigFrom(configFile, configEnvironment string, ignoreExistErrors bool)
 	if conf.Keyspace == "" {
 		return Config{}, errors.New("keyspace is required")
 	}
-	conf.Keyspace = os.ExpandEnv(conf.Keyspace)
 	if specialCharactersRegex.Match([]byte(conf.Keyspace)) {
 		return Config{}, errors.New("keyspace contains special characters")
 	}
-	conf.Connection.Port = os.ExpandEnv(conf.Connection.Port)
 	if conf.Connection.Port == "" {
 		conf.Connection.Port = DefaultConfigPort
 	}
-	conf.Connection.Username = os.ExpandEnv(conf.Connection.Username)
-	if conf.Connection.Username == "" {
-		conf.Connection.Username = DefaultConfigUsername
-	}
-	conf.Connection.Password = os.ExpandEnv(conf.Connection.Password)
-	if conf.Connection.Password == "" {
-		conf.Connection.Password = DefaultConfigPassword
+	conf.Environment = opts.Environment
+	if err := resolveCredentials(&conf); err != nil {
+		return Config{}, err
 	}
-	conf.MigrationDir = os.ExpandEnv(conf.MigrationDir)
 	if conf.MigrationDir == "" {
 		conf.MigrationDir = DefaultConfigMigrationDir
 	}
-	conf.IgnoreExistErrors = ignoreExistErrors
+	if conf.MigrationTable == "" {
+		conf.MigrationTable = conf.Keyspace + DefaultMigrationTableSuffix
+	}
+	if tableNameRegex.Match([]byte(conf.MigrationTable)) {
+		return Config{}, errors.New("migration table contains special characters")
+	}
+	if specialCharactersRegex.Match([]byte(conf.MigrationKeyspace)) {
+		return Config{}, errors.New("migration keyspace contains special characters")
+	}
+	if conf.OutOfOrder == "" {
+		conf.OutOfOrder = DefaultOutOfOrderPolicy
+	}
+	if err := validateOutOfOrderPolicy(conf.OutOfOrder); err != nil {
+		return Config{}, err
+	}
+	if conf.Versioning == "" {
+		conf.Versioning = DefaultVersioning
+	}
+	if err := validateVersioning(conf.Versioning); err != nil {
+		return Config{}, err
+	}
+	if conf.Connection.TLS != nil {
+		if err := validateTLSConfig(*conf.Connection.TLS, conf.IsDevelopment()); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := validateConnectionOptions(&conf.Connection); err != nil {
+		return Config{}, err
+	}
+	conf.IgnoreExistErrors = opts.IgnoreExistErrors
 
 	return conf, nil
 }
+
+func validateConnectionOptions(conn *Connection) error {
+	if conn.ProtocolVersion == "" {
+		conn.ProtocolVersion = DefaultConfigProtocolVersion
+	}
+	if _, err := parseProtocolVersion(conn.ProtocolVersion); err != nil {
+		return err
+	}
+	if conn.Consistency != "" {
+		if _, err := parseConsistency(conn.Consistency); err != nil {
+			return err
+		}
+	}
+	if conn.ConnectTimeout != "" {
+		if _, err := parseTimeout("connect_timeout", conn.ConnectTimeout); err != nil {
+			return err
+		}
+	}
+	if conn.RequestTimeout != "" {
+		if _, err := parseTimeout("request_timeout", conn.RequestTimeout); err != nil {
+			return err
+		}
+	}
+	if conn.NumConnections != "" {
+		if _, err := parsePositiveInt("num_connections", conn.NumConnections); err != nil {
+			return err
+		}
+	}
+	if conn.RetryPolicy != nil {
+		if _, err := newRetryPolicy(*conn.RetryPolicy); err != nil {
+			return err
+		}
+	}
+	if _, err := newHostSelectionPolicy(conn.HostSelection, conn.LocalDC); err != nil {
+		return err
+	}
+	if len(conn.AddressTranslation) > 0 {
+		if _, err := newAddressTranslator(conn.AddressTranslation); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateTLSConfig(conf TLSConfig, development bool) error {
+	if (conf.CertFile == "") != (conf.KeyFile == "") {
+		return errors.New("tls cert_file and key_file must be set together")
+	}
+	if conf.InsecureSkipVerify && !development {
+		return errors.New("tls insecure_skip_verify is only allowed in development environments, set development: true to allow it")
+	}
+	files := []struct {
+		name string
+		path string
+	}{
+		{name: "ca_file", path: conf.CAFile},
+		{name: "cert_file", path: conf.CertFile},
+		{name: "key_file", path: conf.KeyFile},
+	}
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			return fmt.Errorf("tls %s: %w", file.name, err)
+		}
+	}
+
+	return nil
+}
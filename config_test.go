@@ -39,9 +39,122 @@ development:
 	assert.Equal(t, "team_user", conf.Connection.Username)
 	assert.Equal(t, "team_pass", conf.Connection.Password)
 	assert.Equal(t, DefaultConfigMigrationDir, conf.MigrationDir)
+	assert.Equal(t, "bloodlab_migrations", conf.MigrationTable)
+	assert.Empty(t, conf.MigrationKeyspace)
+	assert.Equal(t, `"bloodlab_migrations"`, conf.TrackingTable())
 	assert.True(t, conf.IgnoreExistErrors)
 }
 
+func TestGetConfigFrom_CustomTrackingTable(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  migration_table: app_schema_migrations
+  migration_keyspace: tracking
+  connection:
+    hosts:
+      - 127.0.0.1
+`)
+
+	conf, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, "app_schema_migrations", conf.MigrationTable)
+	assert.Equal(t, "tracking", conf.MigrationKeyspace)
+	assert.Equal(t, `"tracking"."app_schema_migrations"`, conf.TrackingTable())
+}
+
+func TestGetConfigFrom_InvalidMigrationTable(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  migration_table: app-migrations
+  connection:
+    hosts:
+      - 127.0.0.1
+`)
+
+	_, err := GetConfigFrom(configFile, "development", false)
+	require.Error(t, err)
+	assert.Equal(t, "migration table contains special characters", err.Error())
+}
+
+func TestGetConfigFrom_OutOfOrderPolicy(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+production:
+  keyspace: bloodlab
+  out_of_order: fail
+  connection:
+    auth: none
+    hosts:
+      - 127.0.0.1
+staging:
+  keyspace: bloodlab
+  out_of_order: sometimes
+  connection:
+    auth: none
+    hosts:
+      - 127.0.0.1
+`)
+
+	conf, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+	assert.Equal(t, OutOfOrderWarn, conf.OutOfOrder)
+
+	conf, err = GetConfigFrom(configFile, "production", false)
+	require.NoError(t, err)
+	assert.Equal(t, OutOfOrderFail, conf.OutOfOrder)
+
+	_, err = GetConfigFrom(configFile, "staging", false)
+	require.Error(t, err)
+	assert.Equal(t, `invalid out_of_order "sometimes": must be allow, warn or fail`, err.Error())
+}
+
+func TestGetConfigFrom_Versioning(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+sequential:
+  keyspace: bloodlab
+  versioning: sequential
+  development: true
+  connection:
+    hosts:
+      - 127.0.0.1
+invalid:
+  keyspace: bloodlab
+  versioning: semver
+  development: true
+  connection:
+    hosts:
+      - 127.0.0.1
+`)
+
+	conf, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+	assert.Equal(t, VersioningTimestamp, conf.Versioning)
+
+	conf, err = GetConfigFrom(configFile, "sequential", false)
+	require.NoError(t, err)
+	assert.Equal(t, VersioningSequential, conf.Versioning)
+
+	_, err = GetConfigFrom(configFile, "invalid", false)
+	require.Error(t, err)
+	assert.Equal(t, `invalid versioning "semver": must be timestamp, utc or sequential`, err.Error())
+}
+
 func TestGetConfigFrom_MissingEnvironment(t *testing.T) {
 	configFile := writeConfigFile(t, `
 development:
@@ -84,6 +197,223 @@ development:
 	assert.Equal(t, "keyspace contains special characters", err.Error())
 }
 
+func TestGetConfigFrom_TLS(t *testing.T) {
+	certDir := t.TempDir()
+	for _, name := range []string{"ca.pem", "client.pem", "client.key"} {
+		require.NoError(t, os.WriteFile(filepath.Join(certDir, name), []byte("test"), 0o600))
+	}
+	t.Setenv("TEST_CERT_DIR", certDir)
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    tls:
+      ca_file: ${TEST_CERT_DIR}/ca.pem
+      cert_file: ${TEST_CERT_DIR}/client.pem
+      key_file: ${TEST_CERT_DIR}/client.key
+      server_name: cassandra.internal
+`)
+
+	conf, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+
+	require.NotNil(t, conf.Connection.TLS)
+	assert.Equal(t, filepath.Join(certDir, "ca.pem"), conf.Connection.TLS.CAFile)
+	assert.Equal(t, filepath.Join(certDir, "client.pem"), conf.Connection.TLS.CertFile)
+	assert.Equal(t, filepath.Join(certDir, "client.key"), conf.Connection.TLS.KeyFile)
+	assert.Equal(t, "cassandra.internal", conf.Connection.TLS.ServerName)
+	assert.False(t, conf.Connection.TLS.InsecureSkipVerify)
+}
+
+func TestGetConfigFrom_TLSInsecureSkipVerify(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    tls:
+      insecure_skip_verify: true
+production:
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    username: app
+    password: secret
+    tls:
+      insecure_skip_verify: true
+`)
+
+	conf, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+	assert.True(t, conf.Connection.TLS.InsecureSkipVerify)
+
+	_, err = GetConfigFrom(configFile, "production", false)
+	assert.EqualError(t, err, "tls insecure_skip_verify is only allowed in development environments, set development: true to allow it")
+}
+
+func TestGetConfigFrom_TLSMissingFile(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    tls:
+      ca_file: /does/not/exist/ca.pem
+`)
+
+	_, err := GetConfigFrom(configFile, "development", false)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.Contains(t, err.Error(), "tls ca_file")
+}
+
+func TestGetConfigFrom_TLSCertWithoutKey(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    tls:
+      cert_file: client.pem
+`)
+
+	_, err := GetConfigFrom(configFile, "development", false)
+	require.Error(t, err)
+	assert.Equal(t, "tls cert_file and key_file must be set together", err.Error())
+}
+
+func TestGetConfigFrom_DriverOptions(t *testing.T) {
+	t.Setenv("TEST_CONSISTENCY", "LOCAL_QUORUM")
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    consistency: ${TEST_CONSISTENCY}
+    connect_timeout: 5s
+    request_timeout: 30s
+    protocol_version: auto
+    num_connections: "2"
+    retry_policy:
+      type: exponential
+      num_retries: "5"
+      min_backoff: 100ms
+      max_backoff: 2s
+`)
+
+	conf, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, "LOCAL_QUORUM", conf.Connection.Consistency)
+	assert.Equal(t, "5s", conf.Connection.ConnectTimeout)
+	assert.Equal(t, "30s", conf.Connection.RequestTimeout)
+	assert.Equal(t, ProtocolVersionAuto, conf.Connection.ProtocolVersion)
+	assert.Equal(t, "2", conf.Connection.NumConnections)
+	require.NotNil(t, conf.Connection.RetryPolicy)
+	assert.Equal(t, RetryPolicyConfig{Type: "exponential", NumRetries: "5", MinBackoff: "100ms", MaxBackoff: "2s"}, *conf.Connection.RetryPolicy)
+}
+
+func TestGetConfigFrom_DefaultProtocolVersion(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+`)
+
+	conf, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, DefaultConfigProtocolVersion, conf.Connection.ProtocolVersion)
+}
+
+func TestGetConfigFrom_InvalidDriverOptions(t *testing.T) {
+	tests := []struct {
+		option string
+		error  string
+	}{
+		{option: "consistency: most", error: `invalid consistency "most"`},
+		{option: "connect_timeout: soon", error: `invalid connect_timeout "soon"`},
+		{option: "request_timeout: -1s", error: `invalid request_timeout "-1s": must be positive`},
+		{option: "protocol_version: \"2\"", error: `invalid protocol_version "2": must be 3, 4, 5 or auto`},
+		{option: "num_connections: \"0\"", error: `invalid num_connections "0": must be a positive integer`},
+		{option: "retry_policy: {type: forever}", error: `invalid retry_policy type "forever": must be simple or exponential`},
+		{option: "retry_policy: {type: simple, num_retries: many}", error: `invalid retry_policy num_retries "many": must be a non-negative integer`},
+		{option: "retry_policy: {type: exponential, min_backoff: 10s, max_backoff: 1s}", error: "retry_policy min_backoff must not exceed max_backoff"},
+	}
+
+	for _, test := range tests {
+		configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    `+test.option+`
+`)
+
+		_, err := GetConfigFrom(configFile, "development", false)
+		require.Error(t, err, test.option)
+		assert.Contains(t, err.Error(), test.error, test.option)
+	}
+}
+
+func TestGetConfigFrom_HostSelectionAndAddressTranslation(t *testing.T) {
+	t.Setenv("TEST_PUBLIC_IP", "203.0.113.1")
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    local_dc: dc1
+    host_selection: token_aware
+    disable_initial_host_lookup: true
+    address_translation:
+      "10.0.0.1": ${TEST_PUBLIC_IP}
+`)
+
+	conf, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, "dc1", conf.Connection.LocalDC)
+	assert.Equal(t, HostSelectionTokenAware, conf.Connection.HostSelection)
+	assert.True(t, conf.Connection.DisableInitialHostLookup)
+	assert.Equal(t, map[string]string{"10.0.0.1": "203.0.113.1"}, conf.Connection.AddressTranslation)
+}
+
+func TestGetConfigFrom_DCAwareWithoutLocalDC(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    host_selection: dc_aware
+`)
+
+	_, err := GetConfigFrom(configFile, "development", false)
+	require.Error(t, err)
+	assert.Equal(t, "host_selection dc_aware requires local_dc", err.Error())
+}
+
 func TestGetConfig_DefaultOptionsFileMissing(t *testing.T) {
 	wd, err := os.Getwd()
 	require.NoError(t, err)
@@ -0,0 +1,316 @@
+package migrate
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+const (
+	// ProtocolVersionAuto lets the driver negotiate the protocol version with the cluster.
+	ProtocolVersionAuto = "auto"
+
+	RetryPolicySimple      = "simple"
+	RetryPolicyExponential = "exponential"
+
+	HostSelectionRoundRobin = "round_robin"
+	HostSelectionDCAware    = "dc_aware"
+	HostSelectionTokenAware = "token_aware"
+)
+
+// GetConnection creates a Cassandra session for keyspace with password
+// authentication and protocol version 5.
+//
+// Deprecated: Use Connect, which applies all connection settings of a Config.
+func GetConnection(hosts []string, port int, keyspace, username, password string) (*gocql.Session, error) {
+	return Connect(Config{
+		Keyspace: keyspace,
+		Connection: Connection{
+			Hosts:    hosts,
+			Port:     strconv.Itoa(port),
+			Username: username,
+			Password: password,
+		},
+	})
+}
+
+// Connect creates a Cassandra session for the configured keyspace.
+func Connect(conf Config) (*gocql.Session, error) {
+	cluster, err := NewClusterConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	logger := conf.logger()
+	if conf.UsesDefaultCredentials() {
+		logger.Warn("using default credentials")
+	}
+	logger.Info("connecting to cassandra", "hosts", cluster.Hosts, "port", cluster.Port, "keyspace", cluster.Keyspace)
+	session, err := cluster.CreateSession()
+	if err != nil {
+		logger.Error("connection failed", "error", err)
+		return nil, err
+	}
+	logger.Debug("connected to cassandra")
+
+	return session, nil
+}
+
+// NewClusterConfig builds the gocql cluster configuration for conf without
+// connecting to the cluster. Empty optional settings keep the driver defaults.
+func NewClusterConfig(conf Config) (*gocql.ClusterConfig, error) {
+	port, err := strconv.Atoi(conf.Connection.Port)
+	if err != nil {
+		return nil, err
+	}
+	cluster := gocql.NewCluster(conf.Connection.Hosts...)
+	cluster.Port = port
+	cluster.Keyspace = conf.Keyspace
+	cluster.ProtoVersion, err = parseProtocolVersion(conf.Connection.ProtocolVersion)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case conf.Connection.Authenticator != nil:
+		cluster.Authenticator = conf.Connection.Authenticator
+	case conf.Connection.Auth != AuthNone:
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: conf.Connection.Username,
+			Password: conf.Connection.Password,
+		}
+	}
+	if conf.Connection.Consistency != "" {
+		cluster.Consistency, err = parseConsistency(conf.Connection.Consistency)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conf.Connection.ConnectTimeout != "" {
+		cluster.ConnectTimeout, err = parseTimeout("connect_timeout", conf.Connection.ConnectTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conf.Connection.RequestTimeout != "" {
+		cluster.Timeout, err = parseTimeout("request_timeout", conf.Connection.RequestTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conf.Connection.NumConnections != "" {
+		cluster.NumConns, err = parsePositiveInt("num_connections", conf.Connection.NumConnections)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conf.Connection.RetryPolicy != nil {
+		cluster.RetryPolicy, err = newRetryPolicy(*conf.Connection.RetryPolicy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if conf.Connection.TLS != nil {
+		cluster.SslOpts = newSslOptions(*conf.Connection.TLS)
+	}
+	hostSelectionPolicy, err := newHostSelectionPolicy(conf.Connection.HostSelection, conf.Connection.LocalDC)
+	if err != nil {
+		return nil, err
+	}
+	if hostSelectionPolicy != nil {
+		cluster.PoolConfig.HostSelectionPolicy = hostSelectionPolicy
+	}
+	cluster.DisableInitialHostLookup = conf.Connection.DisableInitialHostLookup
+	if len(conf.Connection.AddressTranslation) > 0 {
+		cluster.AddressTranslator, err = newAddressTranslator(conf.Connection.AddressTranslation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cluster, nil
+}
+
+func newSslOptions(conf TLSConfig) *gocql.SslOptions {
+	return &gocql.SslOptions{
+		Config: &tls.Config{
+			ServerName:         conf.ServerName,
+			InsecureSkipVerify: conf.InsecureSkipVerify,
+		},
+		CaPath:                 conf.CAFile,
+		CertPath:               conf.CertFile,
+		KeyPath:                conf.KeyFile,
+		EnableHostVerification: !conf.InsecureSkipVerify,
+	}
+}
+
+// newHostSelectionPolicy returns the configured host selection policy, or nil
+// to keep the driver default. Without an explicit policy, a configured local
+// datacenter selects token-aware routing restricted to that datacenter.
+func newHostSelectionPolicy(hostSelection, localDC string) (gocql.HostSelectionPolicy, error) {
+	switch strings.ToLower(hostSelection) {
+	case "":
+		if localDC == "" {
+			return nil, nil
+		}
+		return gocql.TokenAwareHostPolicy(gocql.DCAwareRoundRobinPolicy(localDC)), nil
+	case HostSelectionRoundRobin:
+		return gocql.RoundRobinHostPolicy(), nil
+	case HostSelectionDCAware:
+		if localDC == "" {
+			return nil, fmt.Errorf("host_selection %s requires local_dc", HostSelectionDCAware)
+		}
+		return gocql.DCAwareRoundRobinPolicy(localDC), nil
+	case HostSelectionTokenAware:
+		if localDC == "" {
+			return gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy()), nil
+		}
+		return gocql.TokenAwareHostPolicy(gocql.DCAwareRoundRobinPolicy(localDC)), nil
+	default:
+		return nil, fmt.Errorf("invalid host_selection %q: must be %s, %s or %s", hostSelection, HostSelectionRoundRobin, HostSelectionDCAware, HostSelectionTokenAware)
+	}
+}
+
+// newAddressTranslator maps advertised node addresses to reachable ones. Keys
+// and values are either "ip" or "ip:port"; an "ip:port" key takes precedence
+// over a plain "ip" key, and a value without port keeps the advertised port.
+func newAddressTranslator(translation map[string]string) (gocql.AddressTranslator, error) {
+	type address struct {
+		ip   net.IP
+		port int
+	}
+	translated := make(map[string]address, len(translation))
+	for from, to := range translation {
+		fromIP, fromPort, err := parseTranslationAddress(from)
+		if err != nil {
+			return nil, err
+		}
+		toIP, toPort, err := parseTranslationAddress(to)
+		if err != nil {
+			return nil, err
+		}
+		key := fromIP.String()
+		if fromPort != 0 {
+			key = net.JoinHostPort(key, strconv.Itoa(fromPort))
+		}
+		translated[key] = address{ip: toIP, port: toPort}
+	}
+
+	return gocql.AddressTranslatorFunc(func(addr net.IP, port int) (net.IP, int) {
+		target, ok := translated[net.JoinHostPort(addr.String(), strconv.Itoa(port))]
+		if !ok {
+			target, ok = translated[addr.String()]
+		}
+		if !ok {
+			return addr, port
+		}
+		if target.port == 0 {
+			return target.ip, port
+		}
+		return target.ip, target.port
+	}), nil
+}
+
+func parseTranslationAddress(address string) (net.IP, int, error) {
+	host, port := address, 0
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		host = h
+		port, err = strconv.Atoi(p)
+		if err != nil || port <= 0 {
+			return nil, 0, fmt.Errorf("invalid address_translation port in %q", address)
+		}
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, 0, fmt.Errorf("invalid address_translation address %q: must be an IP address", address)
+	}
+
+	return ip, port, nil
+}
+
+// parseProtocolVersion maps the configured protocol version to the driver
+// value, where 0 means auto-negotiation.
+func parseProtocolVersion(version string) (int, error) {
+	switch strings.ToLower(version) {
+	case "":
+		version = DefaultConfigProtocolVersion
+	case ProtocolVersionAuto:
+		return 0, nil
+	}
+	parsed, err := strconv.Atoi(version)
+	if err != nil || parsed < 3 || parsed > 5 {
+		return 0, fmt.Errorf("invalid protocol_version %q: must be 3, 4, 5 or %s", version, ProtocolVersionAuto)
+	}
+
+	return parsed, nil
+}
+
+func parseConsistency(consistency string) (gocql.Consistency, error) {
+	parsed, err := gocql.ParseConsistencyWrapper(consistency)
+	if err != nil {
+		return 0, fmt.Errorf("invalid consistency %q", consistency)
+	}
+
+	return parsed, nil
+}
+
+func parseTimeout(name, timeout string) (time.Duration, error) {
+	parsed, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, timeout, err)
+	}
+	if parsed <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be positive", name, timeout)
+	}
+
+	return parsed, nil
+}
+
+func parsePositiveInt(name, value string) (int, error) {
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive integer", name, value)
+	}
+
+	return parsed, nil
+}
+
+func newRetryPolicy(conf RetryPolicyConfig) (gocql.RetryPolicy, error) {
+	numRetries := 0
+	if conf.NumRetries != "" {
+		var err error
+		numRetries, err = strconv.Atoi(conf.NumRetries)
+		if err != nil || numRetries < 0 {
+			return nil, fmt.Errorf("invalid retry_policy num_retries %q: must be a non-negative integer", conf.NumRetries)
+		}
+	}
+	switch strings.ToLower(conf.Type) {
+	case RetryPolicySimple:
+		return &gocql.SimpleRetryPolicy{NumRetries: numRetries}, nil
+	case RetryPolicyExponential:
+		policy := &gocql.ExponentialBackoffRetryPolicy{NumRetries: numRetries}
+		var err error
+		if conf.MinBackoff != "" {
+			policy.Min, err = parseTimeout("retry_policy min_backoff", conf.MinBackoff)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if conf.MaxBackoff != "" {
+			policy.Max, err = parseTimeout("retry_policy max_backoff", conf.MaxBackoff)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if policy.Max != 0 && policy.Min > policy.Max {
+			return nil, errors.New("retry_policy min_backoff must not exceed max_backoff")
+		}
+		return policy, nil
+	default:
+		return nil, fmt.Errorf("invalid retry_policy type %q: must be %s or %s", conf.Type, RetryPolicySimple, RetryPolicyExponential)
+	}
+}
@@ -0,0 +1,207 @@
+package migrate
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClusterConfig_AppliesConnectionSettings(t *testing.T) {
+	conf := Config{
+		Keyspace: "bloodlab",
+		Connection: Connection{
+			Hosts:    []string{"10.0.0.1", "10.0.0.2"},
+			Port:     "9142",
+			Username: "team_user",
+			Password: "team_pass",
+		},
+	}
+
+	cluster, err := NewClusterConfig(conf)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, cluster.Hosts)
+	assert.Equal(t, 9142, cluster.Port)
+	assert.Equal(t, "bloodlab", cluster.Keyspace)
+	assert.Equal(t, gocql.PasswordAuthenticator{Username: "team_user", Password: "team_pass"}, cluster.Authenticator)
+	assert.Nil(t, cluster.SslOpts)
+	assert.Equal(t, 5, cluster.ProtoVersion)
+}
+
+func TestNewClusterConfig_DriverOptions(t *testing.T) {
+	conf := Config{
+		Connection: Connection{
+			Hosts:           []string{"10.0.0.1"},
+			Port:            DefaultConfigPort,
+			Consistency:     "local_quorum",
+			ConnectTimeout:  "5s",
+			RequestTimeout:  "1m",
+			ProtocolVersion: "4",
+			NumConnections:  "4",
+			RetryPolicy: &RetryPolicyConfig{
+				Type:       RetryPolicyExponential,
+				NumRetries: "3",
+				MinBackoff: "200ms",
+				MaxBackoff: "5s",
+			},
+		},
+	}
+
+	cluster, err := NewClusterConfig(conf)
+	require.NoError(t, err)
+
+	assert.Equal(t, gocql.LocalQuorum, cluster.Consistency)
+	assert.Equal(t, 5*time.Second, cluster.ConnectTimeout)
+	assert.Equal(t, time.Minute, cluster.Timeout)
+	assert.Equal(t, 4, cluster.ProtoVersion)
+	assert.Equal(t, 4, cluster.NumConns)
+	assert.Equal(t, &gocql.ExponentialBackoffRetryPolicy{NumRetries: 3, Min: 200 * time.Millisecond, Max: 5 * time.Second}, cluster.RetryPolicy)
+}
+
+func TestNewClusterConfig_ProtocolVersionAuto(t *testing.T) {
+	conf := Config{
+		Connection: Connection{
+			Hosts:           []string{"10.0.0.1"},
+			Port:            DefaultConfigPort,
+			ProtocolVersion: ProtocolVersionAuto,
+			RetryPolicy:     &RetryPolicyConfig{Type: RetryPolicySimple, NumRetries: "2"},
+		},
+	}
+
+	cluster, err := NewClusterConfig(conf)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, cluster.ProtoVersion)
+	assert.Equal(t, &gocql.SimpleRetryPolicy{NumRetries: 2}, cluster.RetryPolicy)
+}
+
+func TestNewClusterConfig_TLS(t *testing.T) {
+	conf := Config{
+		Keyspace: "bloodlab",
+		Connection: Connection{
+			Hosts: []string{"10.0.0.1"},
+			Port:  DefaultConfigPort,
+			TLS: &TLSConfig{
+				CAFile:     "ca.pem",
+				CertFile:   "client.pem",
+				KeyFile:    "client.key",
+				ServerName: "cassandra.internal",
+			},
+		},
+	}
+
+	cluster, err := NewClusterConfig(conf)
+	require.NoError(t, err)
+
+	require.NotNil(t, cluster.SslOpts)
+	assert.Equal(t, "ca.pem", cluster.SslOpts.CaPath)
+	assert.Equal(t, "client.pem", cluster.SslOpts.CertPath)
+	assert.Equal(t, "client.key", cluster.SslOpts.KeyPath)
+	assert.Equal(t, "cassandra.internal", cluster.SslOpts.Config.ServerName)
+	assert.True(t, cluster.SslOpts.EnableHostVerification)
+	assert.False(t, cluster.SslOpts.Config.InsecureSkipVerify)
+}
+
+func TestNewClusterConfig_TLSInsecureSkipVerify(t *testing.T) {
+	conf := Config{
+		Connection: Connection{
+			Hosts: []string{"10.0.0.1"},
+			Port:  DefaultConfigPort,
+			TLS:   &TLSConfig{InsecureSkipVerify: true},
+		},
+	}
+
+	cluster, err := NewClusterConfig(conf)
+	require.NoError(t, err)
+
+	require.NotNil(t, cluster.SslOpts)
+	assert.False(t, cluster.SslOpts.EnableHostVerification)
+	assert.True(t, cluster.SslOpts.Config.InsecureSkipVerify)
+}
+
+func TestNewClusterConfig_InvalidPort(t *testing.T) {
+	conf := Config{
+		Connection: Connection{
+			Port: "invalid",
+		},
+	}
+
+	_, err := NewClusterConfig(conf)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid syntax")
+}
+
+func TestNewClusterConfig_LocalDCDefaultsToTokenAwareDCAwarePolicy(t *testing.T) {
+	conf := Config{
+		Connection: Connection{
+			Hosts:                    []string{"10.0.0.1"},
+			Port:                     DefaultConfigPort,
+			LocalDC:                  "dc1",
+			DisableInitialHostLookup: true,
+		},
+	}
+
+	cluster, err := NewClusterConfig(conf)
+	require.NoError(t, err)
+
+	assert.Equal(t, "*gocql.tokenAwareHostPolicy", fmt.Sprintf("%T", cluster.PoolConfig.HostSelectionPolicy))
+	assert.True(t, cluster.DisableInitialHostLookup)
+}
+
+func TestNewHostSelectionPolicy(t *testing.T) {
+	tests := []struct {
+		hostSelection string
+		localDC       string
+		policyType    string
+		error         string
+	}{
+		{hostSelection: "", localDC: "", policyType: "<nil>"},
+		{hostSelection: HostSelectionRoundRobin, policyType: "*gocql.roundRobinHostPolicy"},
+		{hostSelection: HostSelectionDCAware, localDC: "dc1", policyType: "*gocql.dcAwareRR"},
+		{hostSelection: HostSelectionTokenAware, policyType: "*gocql.tokenAwareHostPolicy"},
+		{hostSelection: HostSelectionDCAware, error: "host_selection dc_aware requires local_dc"},
+		{hostSelection: "nearest", error: `invalid host_selection "nearest"`},
+	}
+
+	for _, test := range tests {
+		policy, err := newHostSelectionPolicy(test.hostSelection, test.localDC)
+		if test.error != "" {
+			require.Error(t, err, test.hostSelection)
+			assert.Contains(t, err.Error(), test.error, test.hostSelection)
+			continue
+		}
+		require.NoError(t, err, test.hostSelection)
+		assert.Equal(t, test.policyType, fmt.Sprintf("%T", policy), test.hostSelection)
+	}
+}
+
+func TestNewAddressTranslator(t *testing.T) {
+	translator, err := newAddressTranslator(map[string]string{
+		"10.0.0.1":      "203.0.113.1",
+		"10.0.0.2:9042": "203.0.113.2:19042",
+	})
+	require.NoError(t, err)
+
+	ip, port := translator.Translate(net.ParseIP("10.0.0.1"), 9042)
+	assert.Equal(t, "203.0.113.1", ip.String())
+	assert.Equal(t, 9042, port)
+
+	ip, port = translator.Translate(net.ParseIP("10.0.0.2"), 9042)
+	assert.Equal(t, "203.0.113.2", ip.String())
+	assert.Equal(t, 19042, port)
+
+	ip, port = translator.Translate(net.ParseIP("10.0.0.2"), 9043)
+	assert.Equal(t, "10.0.0.2", ip.String())
+	assert.Equal(t, 9043, port)
+}
+
+func TestNewAddressTranslator_InvalidAddress(t *testing.T) {
+	_, err := newAddressTranslator(map[string]string{"cassandra-1": "203.0.113.1"})
+	require.Error(t, err)
+	assert.Equal(t, `invalid address_translation address "cassandra-1": must be an IP address`, err.Error())
+}
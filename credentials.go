@@ -0,0 +1,163 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+const (
+	AuthPassword = "password"
+	AuthNone     = "none"
+)
+
+// ErrDefaultCredentials is returned when the default cassandra/cassandra
+// credentials are used outside a development environment.
+var ErrDefaultCredentials = errors.New("default credentials are refused, set development: true to allow them")
+
+// IsDevelopment reports whether the environment is marked as development with
+// the development setting. The environment name is not considered.
+func (c Config) IsDevelopment() bool {
+	return c.Development
+}
+
+// UsesDefaultCredentials reports whether password authentication is configured
+// with DefaultConfigUsername and DefaultConfigPassword.
+func (c Config) UsesDefaultCredentials() bool {
+	return c.Connection.Auth != AuthNone &&
+		c.Connection.Username == DefaultConfigUsername &&
+		c.Connection.Password == DefaultConfigPassword
+}
+
+// RedactedValue replaces secrets in Config.Redacted.
+const RedactedValue = "REDACTED"
+
+// Redacted returns a copy of the config with secrets replaced by RedactedValue,
+// suitable for printing: the password, the arguments of password_command and
+// credentials embedded in hosts and address translations. The Authenticator
+// is removed.
+func (c Config) Redacted() Config {
+	conn := &c.Connection
+	if conn.Password != "" {
+		conn.Password = RedactedValue
+	}
+	if len(conn.PasswordCommand) > 1 {
+		command := []string{conn.PasswordCommand[0]}
+		for range conn.PasswordCommand[1:] {
+			command = append(command, RedactedValue)
+		}
+		conn.PasswordCommand = command
+	}
+	if len(conn.Hosts) > 0 {
+		hosts := make([]string, 0, len(conn.Hosts))
+		for _, host := range conn.Hosts {
+			hosts = append(hosts, redactUserinfo(host))
+		}
+		conn.Hosts = hosts
+	}
+	if len(conn.AddressTranslation) > 0 {
+		translation := make(map[string]string, len(conn.AddressTranslation))
+		for from, to := range conn.AddressTranslation {
+			translation[redactUserinfo(from)] = redactUserinfo(to)
+		}
+		conn.AddressTranslation = translation
+	}
+	conn.Authenticator = nil
+
+	return c
+}
+
+var userinfoRegex = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*://)?([^@/]+)@`)
+
+// redactUserinfo masks credentials in an address such as
+// user:secret@host:9042 or cassandra://token@host. The user name before a
+// colon is kept, a user info without a colon is masked as a whole.
+func redactUserinfo(address string) string {
+	match := userinfoRegex.FindStringSubmatchIndex(address)
+	if match == nil {
+		return address
+	}
+	scheme := ""
+	if match[2] >= 0 {
+		scheme = address[match[2]:match[3]]
+	}
+	userinfo, rest := address[match[4]:match[5]], address[match[5]:]
+	if user, _, ok := strings.Cut(userinfo, ":"); ok {
+		return scheme + user + ":" + RedactedValue + rest
+	}
+
+	return scheme + RedactedValue + rest
+}
+
+// resolveCredentials expands and validates the authentication settings,
+// reading the password from its configured secret source.
+func resolveCredentials(conf *Config) error {
+	conn := &conf.Connection
+	conn.Auth = strings.ToLower(conn.Auth)
+	switch conn.Auth {
+	case "":
+		conn.Auth = AuthPassword
+	case AuthPassword:
+	case AuthNone:
+		if conn.Username != "" || conn.Password != "" || conn.PasswordFile != "" || len(conn.PasswordCommand) > 0 {
+			return errors.New("credentials must not be set when auth is none")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid auth %q: must be %s or %s", conn.Auth, AuthPassword, AuthNone)
+	}
+
+	if conn.Username == "" {
+		conn.Username = DefaultConfigUsername
+	}
+	password, err := readPassword(conn)
+	if err != nil {
+		return err
+	}
+	conn.Password = password
+	if conn.Password == "" {
+		conn.Password = DefaultConfigPassword
+	}
+	if conf.UsesDefaultCredentials() && !conf.IsDevelopment() {
+		return fmt.Errorf("environment %s: %w", conf.Environment, ErrDefaultCredentials)
+	}
+
+	return nil
+}
+
+func readPassword(conn *Connection) (string, error) {
+	sources := 0
+	for _, set := range []bool{conn.Password != "", conn.PasswordFile != "", len(conn.PasswordCommand) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", errors.New("only one of password, password_file and password_command may be set")
+	}
+
+	switch {
+	case conn.PasswordFile != "":
+		content, err := os.ReadFile(conn.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("password_file: %w", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case len(conn.PasswordCommand) > 0:
+		args := conn.PasswordCommand
+		var stderr bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("password_command %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimRight(string(output), "\r\n"), nil
+	default:
+		return conn.Password, nil
+	}
+}
@@ -0,0 +1,189 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetConfigFrom_PasswordFile(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("file_pass\n"), 0o600))
+	t.Setenv("TEST_PASSWORD_FILE", passwordFile)
+	configFile := writeConfigFile(t, `
+production:
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    username: team_user
+    password_file: ${TEST_PASSWORD_FILE}
+`)
+
+	conf, err := GetConfigFrom(configFile, "production", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, "team_user", conf.Connection.Username)
+	assert.Equal(t, "file_pass", conf.Connection.Password)
+	assert.Equal(t, passwordFile, conf.Connection.PasswordFile)
+}
+
+func TestGetConfigFrom_PasswordCommand(t *testing.T) {
+	t.Setenv("TEST_SECRET", "command_pass")
+	configFile := writeConfigFile(t, `
+production:
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    username: team_user
+    password_command: ["echo", "${TEST_SECRET}"]
+`)
+
+	conf, err := GetConfigFrom(configFile, "production", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, "command_pass", conf.Connection.Password)
+}
+
+func TestGetConfigFrom_PasswordCommandFails(t *testing.T) {
+	configFile := writeConfigFile(t, `
+production:
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    username: team_user
+    password_command: ["false"]
+`)
+
+	_, err := GetConfigFrom(configFile, "production", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "password_command false failed")
+}
+
+func TestGetConfigFrom_MultiplePasswordSources(t *testing.T) {
+	configFile := writeConfigFile(t, `
+production:
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    password: literal
+    password_file: /run/secrets/cassandra
+`)
+
+	_, err := GetConfigFrom(configFile, "production", false)
+	require.Error(t, err)
+	assert.Equal(t, "only one of password, password_file and password_command may be set", err.Error())
+}
+
+func TestGetConfigFrom_AuthNone(t *testing.T) {
+	configFile := writeConfigFile(t, `
+production:
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    auth: none
+`)
+
+	conf, err := GetConfigFrom(configFile, "production", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, AuthNone, conf.Connection.Auth)
+	assert.Empty(t, conf.Connection.Username)
+	assert.Empty(t, conf.Connection.Password)
+	assert.False(t, conf.UsesDefaultCredentials())
+
+	cluster, err := NewClusterConfig(conf)
+	require.NoError(t, err)
+	assert.Nil(t, cluster.Authenticator)
+}
+
+func TestGetConfigFrom_AuthNoneWithCredentials(t *testing.T) {
+	configFile := writeConfigFile(t, `
+production:
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    auth: none
+    username: team_user
+`)
+
+	_, err := GetConfigFrom(configFile, "production", false)
+	require.Error(t, err)
+	assert.Equal(t, "credentials must not be set when auth is none", err.Error())
+}
+
+func TestGetConfigFrom_DefaultCredentialsOutsideDevelopment(t *testing.T) {
+	configFile := writeConfigFile(t, `
+production:
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+`)
+
+	_, err := GetConfigFrom(configFile, "production", false)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrDefaultCredentials))
+	assert.Equal(t, "environment production: default credentials are refused, set development: true to allow them", err.Error())
+}
+
+func TestGetConfigFrom_DefaultCredentialsInUnmarkedDevelopment(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  keyspace: bloodlab
+  development: false
+  connection:
+    hosts:
+      - 127.0.0.1
+`)
+
+	_, err := GetConfigFrom(configFile, "development", false)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrDefaultCredentials))
+	assert.Equal(t, "environment development: default credentials are refused, set development: true to allow them", err.Error())
+	assert.False(t, Config{Environment: DefaultConfigEnvironment}.IsDevelopment())
+}
+
+func TestGetConfigFrom_DefaultCredentialsInMarkedDevelopment(t *testing.T) {
+	configFile := writeConfigFile(t, `
+local:
+  keyspace: bloodlab
+  development: true
+  connection:
+    hosts:
+      - 127.0.0.1
+`)
+
+	conf, err := GetConfigFrom(configFile, "local", false)
+	require.NoError(t, err)
+
+	assert.True(t, conf.IsDevelopment())
+	assert.True(t, conf.UsesDefaultCredentials())
+}
+
+func TestNewClusterConfig_CustomAuthenticator(t *testing.T) {
+	authenticator := gocql.PasswordAuthenticator{Username: "injected", Password: "secret"}
+	conf := Config{
+		Connection: Connection{
+			Hosts:         []string{"10.0.0.1"},
+			Port:          DefaultConfigPort,
+			Username:      "ignored",
+			Authenticator: authenticator,
+		},
+	}
+
+	cluster, err := NewClusterConfig(conf)
+	require.NoError(t, err)
+
+	assert.Equal(t, authenticator, cluster.Authenticator)
+}
@@ -2,6 +2,7 @@ package migrate
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	gocql "github.com/apache/cassandra-gocql-driver/v2"
@@ -9,32 +10,42 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
+	"time"
 )
 
 // DownResult summarizes a single ApplyDown execution.
 type DownResult struct {
 	Applied     bool
 	MigrationID string
+	Duration    time.Duration
 }
 
 // ApplyDown executes the Down statements for the latest applied migration.
 func ApplyDown(conf Config) (DownResult, error) {
+	return ApplyDownContext(context.Background(), conf)
+}
+
+// ApplyDownContext is ApplyDown with a context for query cancellation and tracing.
+func ApplyDownContext(ctx context.Context, conf Config) (result DownResult, err error) {
+	ctx, span := startRunSpan(ctx, conf, DirectionDown)
+	defer func() { endSpan(span, err) }()
+
 	migrationFiles, err := filepath.Glob(filepath.Join(conf.MigrationDir, "*.cql"))
 	if err != nil {
 		return DownResult{}, err
 	}
-	port, err := strconv.Atoi(conf.Connection.Port)
+	metrics, err := newMigrationMetrics(conf)
 	if err != nil {
 		return DownResult{}, err
 	}
-	session, err := GetConnection(conf.Connection.Hosts, port, conf.Keyspace, conf.Connection.Username, conf.Connection.Password)
+	session, err := openSession(conf)
 	if err != nil {
 		return DownResult{}, err
 	}
 	defer session.Close()
-	id, err := GetLatestMigrationID(conf.Keyspace, session)
+	id, err := latestMigrationID(ctx, session, conf.TrackingTable())
 	if errors.Is(err, gocql.ErrNotFound) {
+		conf.logger().Info("no migrations to revert")
 		return DownResult{Applied: false}, nil
 	}
 	if err != nil {
@@ -58,27 +69,93 @@ func ApplyDown(conf Config) (DownResult, error) {
 	if err != nil {
 		return DownResult{}, err
 	}
-	for _, statement := range migration.DownStatements {
-		err = session.Query(statement).Exec()
-		if err != nil {
-			if conf.IgnoreExistErrors && IsExistError(err) {
-				continue
-			}
-			return DownResult{}, fmt.Errorf("failed to execute down statement in %s: %w", filepath.Base(filename), err)
-		}
+	err = confirm(conf, ConfirmationRequest{
+		Environment: conf.Environment,
+		Direction:   DirectionDown,
+		Migrations:  []PlannedMigration{{ID: id, Reason: migration.DangerousReason, Statements: migration.DownStatementsFor(conf.Environment)}},
+	})
+	if err != nil {
+		return DownResult{}, err
 	}
-	err = DeleteMigration(conf.Keyspace, id, session)
+	execQuery := func(statement string, args ...any) error {
+		return session.Exec(ctx, statement, args...)
+	}
+	history, err := newHistoryRecorder(conf, execQuery)
 	if err != nil {
 		return DownResult{}, err
 	}
+	hooks := newHookRunner(conf, DirectionDown)
+	if err := hooks.beforeRun(); err != nil {
+		return DownResult{}, err
+	}
+	result = DownResult{MigrationID: id}
+	err = hooks.beforeMigration(id)
+	logger := conf.logger()
+	var duration time.Duration
+	if err == nil {
+		logger.Info("reverting migration", "migration", id, "direction", DirectionDown)
+		migrationCtx, migrationSpan := startMigrationSpan(ctx, conf, id, DirectionDown)
+		migrationExecQuery := sessionExecutor(migrationCtx, session)
+		start := time.Now()
+		err = revertAndDeleteMigration(
+			migrationCtx,
+			conf,
+			filename,
+			migration.DownStatementsFor(conf.Environment),
+			migrationExecQuery,
+		)
+		// a reverted baseline no longer covers the squashed migrations
+		for i := 0; err == nil && i < len(migration.Covers); i++ {
+			err = migrationExecQuery(fmt.Sprintf(deleteMigrationQueryTemplate, conf.TrackingTable()), migration.Covers[i])
+		}
+		duration = time.Since(start)
+		metrics.record(ctx, conf.Keyspace, DirectionDown, duration, err)
+		endSpan(migrationSpan, err)
+		history.record(id, HistoryDown, checksum(content), duration, err)
+	}
+	if err == nil {
+		logger.Info("reverted migration", "migration", id, "direction", DirectionDown, "duration", duration)
+		result.Applied = true
+		result.Duration = duration
+		err = hooks.afterMigration(id)
+	}
+	failedMigrationID := id
+	if err == nil {
+		failedMigrationID = ""
+	} else {
+		err = &MigrationError{MigrationID: id, Err: err}
+	}
+	if err := hooks.finishRun(failedMigrationID, err); err != nil {
+		return result, err
+	}
 
-	return DownResult{Applied: true, MigrationID: id}, nil
+	return result, nil
 }
 
-// GetLatestMigrationID returns the newest applied migration ID by applied_at,
-// breaking ties by descending alphabetical ID order.
+func revertAndDeleteMigration(ctx context.Context, conf Config, file string, statements []string, execQuery queryExecutor) error {
+	migrationID := filepath.Base(file)
+	if err := executeStatements(ctx, conf, migrationID, DirectionDown, statements, execQuery); err != nil {
+		return fmt.Errorf("failed to execute down statement in %s: %w", migrationID, err)
+	}
+
+	return execQuery(fmt.Sprintf(deleteMigrationQueryTemplate, conf.TrackingTable()), migrationID)
+}
+
+// GetLatestMigrationID returns the newest applied migration ID of a keyspace
+// that uses the default tracking table, see GetLatestMigrationIDInTable.
 func GetLatestMigrationID(keyspace string, session *gocql.Session) (string, error) {
-	migrations, err := GetExistingMigrations(keyspace, session)
+	return GetLatestMigrationIDInTable(Config{Keyspace: keyspace}.TrackingTable(), session)
+}
+
+// GetLatestMigrationIDInTable returns the newest migration ID recorded in the
+// given tracking table by applied_at, breaking ties by descending
+// alphabetical ID order.
+func GetLatestMigrationIDInTable(table string, session *gocql.Session) (string, error) {
+	return latestMigrationID(context.Background(), NewSession(session), table)
+}
+
+func latestMigrationID(ctx context.Context, session Session, table string) (string, error) {
+	migrations, err := existingMigrations(ctx, session, table)
 	if err != nil {
 		return "", err
 	}
@@ -92,8 +169,17 @@ func GetLatestMigrationID(keyspace string, session *gocql.Session) (string, erro
 	return migrations[0].ID, nil
 }
 
-// DeleteMigration removes a migration ID from the tracking table.
+const deleteMigrationQueryTemplate = `DELETE FROM %s WHERE id = ?`
+
+// DeleteMigration removes a migration ID from the default tracking table of
+// a keyspace.
 func DeleteMigration(keyspace string, id string, session *gocql.Session) error {
-	query := fmt.Sprintf(`DELETE FROM "%s_migrations" WHERE id = ?`, keyspace)
+	return DeleteMigrationFromTable(Config{Keyspace: keyspace}.TrackingTable(), id, session)
+}
+
+// DeleteMigrationFromTable removes a migration ID from the given tracking
+// table.
+func DeleteMigrationFromTable(table string, id string, session *gocql.Session) error {
+	query := fmt.Sprintf(deleteMigrationQueryTemplate, table)
 	return session.Query(query, id).Exec()
 }
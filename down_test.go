@@ -1,7 +1,9 @@
 package migrate
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"path/filepath"
 	"sort"
 	"testing"
@@ -9,6 +11,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestIsNewerMigration_PrefersLaterAppliedAt(t *testing.T) {
@@ -69,3 +74,112 @@ func TestApplyDown_InvalidPort(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid syntax")
 }
+
+func TestRevertAndDeleteMigration_DeletesAfterDownStatements(t *testing.T) {
+	calls := make([]queryCall, 0)
+	err := revertAndDeleteMigration(
+		context.Background(),
+		Config{Keyspace: "bloodlab"},
+		filepath.Join("migrations", "20260422123000-create-users.cql"),
+		[]string{"DROP TABLE users;"},
+		func(statement string, args ...any) error {
+			calls = append(calls, queryCall{statement: statement, args: args})
+			return nil
+		},
+	)
+	require.NoError(t, err)
+
+	require.Len(t, calls, 2)
+	assert.Equal(t, "DROP TABLE users;", calls[0].statement)
+	assert.Equal(t, `DELETE FROM "bloodlab_migrations" WHERE id = ?`, calls[1].statement)
+	assert.Equal(t, []any{"20260422123000-create-users.cql"}, calls[1].args)
+}
+
+func TestRevertAndDeleteMigration_KeepsRecordWhenStatementFails(t *testing.T) {
+	calls := make([]queryCall, 0)
+	err := revertAndDeleteMigration(
+		context.Background(),
+		Config{Keyspace: "bloodlab"},
+		filepath.Join("migrations", "20260422123000-create-users.cql"),
+		[]string{"DROP TABLE users;"},
+		func(statement string, args ...any) error {
+			calls = append(calls, queryCall{statement: statement, args: args})
+			return errors.New("table in use")
+		},
+	)
+	require.Error(t, err)
+	assert.Equal(t, "failed to execute down statement in 20260422123000-create-users.cql: table in use", err.Error())
+	require.Len(t, calls, 1)
+}
+
+// spanSession records the span of every executed statement and returns rows
+// for every query.
+type spanSession struct {
+	rows  [][]any
+	spans map[string]trace.SpanID
+}
+
+func (s *spanSession) Exec(ctx context.Context, statement string, _ ...any) error {
+	s.spans[statement] = trace.SpanFromContext(ctx).SpanContext().SpanID()
+	return nil
+}
+
+func (s *spanSession) Iter(context.Context, string, ...any) Iter {
+	return &rowsIter{rows: s.rows}
+}
+
+func (s *spanSession) Close() {}
+
+type rowsIter struct {
+	rows [][]any
+}
+
+func (i *rowsIter) Scan(dest ...any) bool {
+	if len(i.rows) == 0 {
+		return false
+	}
+	for index, value := range i.rows[0] {
+		switch target := dest[index].(type) {
+		case *string:
+			*target = value.(string)
+		case *time.Time:
+			*target = value.(time.Time)
+		}
+	}
+	i.rows = i.rows[1:]
+	return true
+}
+
+func (i *rowsIter) Close() error {
+	return nil
+}
+
+func TestApplyDown_RunsStatementsInMigrationSpan(t *testing.T) {
+	tempDir := t.TempDir()
+	writeMigrationFile(t, tempDir, "0001-create-users.cql", "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n-- +migrate Down\nDROP TABLE users;\n")
+	exporter := tracetest.NewInMemoryExporter()
+	session := &spanSession{
+		rows:  [][]any{{"0001-create-users.cql", time.Now()}},
+		spans: make(map[string]trace.SpanID),
+	}
+	conf := Config{
+		Keyspace:       "bloodlab",
+		MigrationDir:   tempDir,
+		Session:        session,
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+	}
+
+	result, err := ApplyDown(conf)
+	require.NoError(t, err)
+	require.True(t, result.Applied)
+
+	var migrationSpan trace.SpanID
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "cassandra_migrate.migration" {
+			migrationSpan = span.SpanContext.SpanID()
+		}
+	}
+	require.True(t, migrationSpan.IsValid())
+	assert.Equal(t, migrationSpan, session.spans["DROP TABLE users;\n"])
+	assert.Equal(t, migrationSpan, session.spans[fmt.Sprintf(deleteMigrationQueryTemplate, conf.TrackingTable())])
+}
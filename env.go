@@ -0,0 +1,123 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrUnsetEnvVariable is returned when a referenced environment variable is
+// not set in strict mode, or when a ${VAR:?message} variable is unset or empty.
+var ErrUnsetEnvVariable = errors.New("environment variable is not set")
+
+// envExpander expands $VAR, ${VAR}, ${VAR:-default} and ${VAR:?message}
+// references and keeps the first error it encounters.
+type envExpander struct {
+	strict bool
+	err    error
+}
+
+func (e *envExpander) expand(field, value string) string {
+	return os.Expand(value, func(expr string) string {
+		expanded, err := lookupEnvExpr(expr, e.strict)
+		if err != nil && e.err == nil {
+			e.err = fmt.Errorf("%s: %w", field, err)
+		}
+		return expanded
+	})
+}
+
+func lookupEnvExpr(expr string, strict bool) (string, error) {
+	name, operator, argument := expr, "", ""
+	if i := strings.Index(expr, ":"); i >= 0 && i+1 < len(expr) && (expr[i+1] == '-' || expr[i+1] == '?') {
+		name, operator, argument = expr[:i], expr[i:i+2], expr[i+2:]
+	}
+
+	value, ok := os.LookupEnv(name)
+	switch operator {
+	case ":-":
+		if value == "" {
+			return argument, nil
+		}
+	case ":?":
+		if value == "" {
+			if argument == "" {
+				argument = "required"
+			}
+			return "", fmt.Errorf("%w: %s: %s", ErrUnsetEnvVariable, name, argument)
+		}
+	default:
+		if !ok && strict {
+			return "", fmt.Errorf("%w: %s", ErrUnsetEnvVariable, name)
+		}
+	}
+
+	return value, nil
+}
+
+// expandConfig expands environment variable references in all string fields
+// of conf. Field names in errors use the YAML keys.
+func expandConfig(conf *Config, strict bool) error {
+	env := &envExpander{strict: strict}
+
+	conf.Keyspace = env.expand("keyspace", conf.Keyspace)
+	conf.MigrationDir = env.expand("migration_dir", conf.MigrationDir)
+	conf.MigrationTable = env.expand("migration_table", conf.MigrationTable)
+	conf.MigrationKeyspace = env.expand("migration_keyspace", conf.MigrationKeyspace)
+	conf.OutOfOrder = env.expand("out_of_order", conf.OutOfOrder)
+	conf.Versioning = env.expand("versioning", conf.Versioning)
+	conf.MigrationTemplate = env.expand("migration_template", conf.MigrationTemplate)
+
+	conn := &conf.Connection
+	hosts := make([]string, len(conn.Hosts))
+	for i, host := range conn.Hosts {
+		hosts[i] = env.expand(fmt.Sprintf("connection.hosts[%d]", i), host)
+	}
+	conn.Hosts = hosts
+	conn.Port = env.expand("connection.port", conn.Port)
+	conn.Auth = env.expand("connection.auth", conn.Auth)
+	conn.Username = env.expand("connection.username", conn.Username)
+	conn.Password = env.expand("connection.password", conn.Password)
+	conn.PasswordFile = env.expand("connection.password_file", conn.PasswordFile)
+	if len(conn.PasswordCommand) > 0 {
+		args := make([]string, len(conn.PasswordCommand))
+		for i, arg := range conn.PasswordCommand {
+			args[i] = env.expand(fmt.Sprintf("connection.password_command[%d]", i), arg)
+		}
+		conn.PasswordCommand = args
+	}
+	if conn.TLS != nil {
+		tlsConf := *conn.TLS
+		tlsConf.CAFile = env.expand("connection.tls.ca_file", tlsConf.CAFile)
+		tlsConf.CertFile = env.expand("connection.tls.cert_file", tlsConf.CertFile)
+		tlsConf.KeyFile = env.expand("connection.tls.key_file", tlsConf.KeyFile)
+		tlsConf.ServerName = env.expand("connection.tls.server_name", tlsConf.ServerName)
+		conn.TLS = &tlsConf
+	}
+	conn.Consistency = env.expand("connection.consistency", conn.Consistency)
+	conn.ConnectTimeout = env.expand("connection.connect_timeout", conn.ConnectTimeout)
+	conn.RequestTimeout = env.expand("connection.request_timeout", conn.RequestTimeout)
+	conn.ProtocolVersion = env.expand("connection.protocol_version", conn.ProtocolVersion)
+	conn.NumConnections = env.expand("connection.num_connections", conn.NumConnections)
+	if conn.RetryPolicy != nil {
+		retryPolicy := *conn.RetryPolicy
+		retryPolicy.Type = env.expand("connection.retry_policy.type", retryPolicy.Type)
+		retryPolicy.NumRetries = env.expand("connection.retry_policy.num_retries", retryPolicy.NumRetries)
+		retryPolicy.MinBackoff = env.expand("connection.retry_policy.min_backoff", retryPolicy.MinBackoff)
+		retryPolicy.MaxBackoff = env.expand("connection.retry_policy.max_backoff", retryPolicy.MaxBackoff)
+		conn.RetryPolicy = &retryPolicy
+	}
+	conn.LocalDC = env.expand("connection.local_dc", conn.LocalDC)
+	conn.HostSelection = env.expand("connection.host_selection", conn.HostSelection)
+	if len(conn.AddressTranslation) > 0 {
+		addressTranslation := make(map[string]string, len(conn.AddressTranslation))
+		for from, to := range conn.AddressTranslation {
+			field := "connection.address_translation." + from
+			addressTranslation[env.expand(field, from)] = env.expand(field, to)
+		}
+		conn.AddressTranslation = addressTranslation
+	}
+
+	return env.err
+}
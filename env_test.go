@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupEnvExpr(t *testing.T) {
+	t.Setenv("TEST_SET", "value")
+	t.Setenv("TEST_EMPTY", "")
+
+	tests := []struct {
+		expr   string
+		strict bool
+		value  string
+		error  string
+	}{
+		{expr: "TEST_SET", value: "value"},
+		{expr: "TEST_UNSET", value: ""},
+		{expr: "TEST_UNSET", strict: true, error: "environment variable is not set: TEST_UNSET"},
+		{expr: "TEST_EMPTY", strict: true, value: ""},
+		{expr: "TEST_SET:-fallback", value: "value"},
+		{expr: "TEST_UNSET:-fallback", strict: true, value: "fallback"},
+		{expr: "TEST_EMPTY:-fallback", value: "fallback"},
+		{expr: "TEST_UNSET:-", strict: true, value: ""},
+		{expr: "TEST_SET:?must be set", value: "value"},
+		{expr: "TEST_UNSET:?must be set", error: "environment variable is not set: TEST_UNSET: must be set"},
+		{expr: "TEST_EMPTY:?", error: "environment variable is not set: TEST_EMPTY: required"},
+	}
+
+	for _, test := range tests {
+		value, err := lookupEnvExpr(test.expr, test.strict)
+		if test.error != "" {
+			require.Error(t, err, test.expr)
+			assert.True(t, errors.Is(err, ErrUnsetEnvVariable), test.expr)
+			assert.Equal(t, test.error, err.Error(), test.expr)
+			continue
+		}
+		require.NoError(t, err, test.expr)
+		assert.Equal(t, test.value, value, test.expr)
+	}
+}
+
+func TestGetConfigFrom_EnvDefaults(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: ${TEST_UNSET_KEYSPACE:-bloodlab}
+  connection:
+    hosts:
+      - ${TEST_UNSET_HOST:-127.0.0.1}
+    port: ${TEST_UNSET_PORT:-9142}
+`)
+
+	conf, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, "bloodlab", conf.Keyspace)
+	assert.Equal(t, []string{"127.0.0.1"}, conf.Connection.Hosts)
+	assert.Equal(t, "9142", conf.Connection.Port)
+}
+
+func TestGetConfigFrom_EnvMigrationSettings(t *testing.T) {
+	t.Setenv("TEST_TEMPLATE_DIR", "/etc/templates")
+	t.Setenv("TEST_VERSIONING", "sequential")
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  migration_template: ${TEST_TEMPLATE_DIR}/m.tmpl
+  out_of_order: ${TEST_UNSET_OUT_OF_ORDER:-fail}
+  versioning: $TEST_VERSIONING
+  connection:
+    hosts:
+      - 127.0.0.1
+`)
+
+	conf, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/etc/templates/m.tmpl", conf.MigrationTemplate)
+	assert.Equal(t, OutOfOrderFail, conf.OutOfOrder)
+	assert.Equal(t, VersioningSequential, conf.Versioning)
+}
+
+func TestGetConfigFrom_RequiredEnvVariable(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    password: ${TEST_UNSET_PASSWORD:?set the cassandra password}
+`)
+
+	_, err := GetConfigFrom(configFile, "development", false)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrUnsetEnvVariable))
+	assert.Equal(t, "connection.password: environment variable is not set: TEST_UNSET_PASSWORD: set the cassandra password", err.Error())
+}
+
+func TestGetConfigWithOptions_StrictRejectsUnsetVariable(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    password: ${TEST_UNSET_PASSWORD}
+`)
+
+	_, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+
+	_, err = GetConfigWithOptions(Options{ConfigFile: configFile, Environment: "development", Strict: true})
+	require.Error(t, err)
+	assert.Equal(t, "connection.password: environment variable is not set: TEST_UNSET_PASSWORD", err.Error())
+}
+
+func TestGetConfigWithOptions_StrictRejectsUnknownKeys(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+    pasword: typo
+`)
+
+	_, err := GetConfigFrom(configFile, "development", false)
+	require.NoError(t, err)
+
+	_, err = GetConfigWithOptions(Options{ConfigFile: configFile, Environment: "development", Strict: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field pasword not found")
+}
@@ -0,0 +1,207 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultsSection is the reserved top-level config key whose settings are
+	// shared by all environments.
+	DefaultsSection = "defaults"
+
+	extendsKey = "extends"
+)
+
+// resolveEnvironments merges the defaults section and each environment's
+// extends chain into the environment's own settings. Maps are merged
+// recursively, all other values, including lists, are replaced.
+func resolveEnvironments(raw map[string]any) (map[string]map[string]any, error) {
+	defaults, err := environmentSettings(DefaultsSection, raw[DefaultsSection])
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := defaults[extendsKey]; ok {
+		return nil, errors.New("defaults must not use extends")
+	}
+
+	resolved := make(map[string]map[string]any)
+	var resolve func(name string, chain []string) (map[string]any, error)
+	resolve = func(name string, chain []string) (map[string]any, error) {
+		if settings, ok := resolved[name]; ok {
+			return settings, nil
+		}
+		for _, visited := range chain {
+			if visited == name {
+				return nil, fmt.Errorf("environment %s: circular extends: %s", chain[0], strings.Join(append(chain, name), " -> "))
+			}
+		}
+		value, ok := raw[name]
+		if !ok || name == DefaultsSection {
+			return nil, fmt.Errorf("environment %s: extends unknown environment %s", chain[len(chain)-1], name)
+		}
+		settings, err := environmentSettings(name, value)
+		if err != nil {
+			return nil, err
+		}
+
+		base := defaults
+		if parent, ok := settings[extendsKey]; ok {
+			parentName, ok := scalarText(parent)
+			if !ok || parentName == "" {
+				return nil, fmt.Errorf("environment %s: extends must name an environment", name)
+			}
+			base, err = resolve(parentName, append(chain, name))
+			if err != nil {
+				return nil, err
+			}
+		}
+		merged := mergeSettings(base, settings)
+		delete(merged, extendsKey)
+		resolved[name] = merged
+
+		return merged, nil
+	}
+
+	for name := range raw {
+		if name == DefaultsSection {
+			continue
+		}
+		if _, err := resolve(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return resolved, nil
+}
+
+func environmentSettings(name string, value any) (map[string]any, error) {
+	if value == nil {
+		return map[string]any{}, nil
+	}
+	settings, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("environment %s: expected a mapping", name)
+	}
+
+	return settings, nil
+}
+
+// nodeSettings converts a mapping node into settings. Nested mappings become
+// maps so that environments can be merged, all other values keep their node.
+// Scalars are thereby decoded into the Config as written, "00123" stays a
+// string instead of passing through the integer 83.
+func nodeSettings(node *yaml.Node) (map[string]any, error) {
+	node = resolveAlias(node)
+	settings := make(map[string]any, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolveAlias(node.Content[i+1])
+		if key.Tag == "!!merge" {
+			merged, err := mergeNodes(value)
+			if err != nil {
+				return nil, err
+			}
+			settings = mergeSettings(merged, settings)
+			continue
+		}
+		switch {
+		case value.Kind == yaml.MappingNode:
+			nested, err := nodeSettings(value)
+			if err != nil {
+				return nil, err
+			}
+			settings[key.Value] = nested
+		case value.Kind == yaml.ScalarNode && value.Tag == "!!null":
+			settings[key.Value] = nil
+		default:
+			settings[key.Value] = value
+		}
+	}
+
+	return settings, nil
+}
+
+// mergeNodes returns the settings of a "<<" merge value, a mapping or a list
+// of mappings where earlier mappings take precedence.
+func mergeNodes(value *yaml.Node) (map[string]any, error) {
+	switch value.Kind {
+	case yaml.MappingNode:
+		return nodeSettings(value)
+	case yaml.SequenceNode:
+		merged := make(map[string]any)
+		for i := len(value.Content) - 1; i >= 0; i-- {
+			item := resolveAlias(value.Content[i])
+			if item.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("line %d: merge value must be a mapping", item.Line)
+			}
+			settings, err := nodeSettings(item)
+			if err != nil {
+				return nil, err
+			}
+			merged = mergeSettings(merged, settings)
+		}
+		return merged, nil
+	default:
+		return nil, fmt.Errorf("line %d: merge value must be a mapping", value.Line)
+	}
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// scalarText returns the text of a scalar setting.
+func scalarText(value any) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case *yaml.Node:
+		return value.Value, value.Kind == yaml.ScalarNode
+	default:
+		return "", false
+	}
+}
+
+// mergeSettings returns a copy of base overlaid with override.
+func mergeSettings(base, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseMap, baseIsMap := merged[key].(map[string]any)
+		overrideMap, overrideIsMap := value.(map[string]any)
+		if baseIsMap && overrideIsMap {
+			merged[key] = mergeSettings(baseMap, overrideMap)
+			continue
+		}
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// decodeEnvironment converts merged environment settings into a Config.
+// In strict mode unknown keys are rejected.
+func decodeEnvironment(settings map[string]any, strict bool) (Config, error) {
+	content, err := yaml.Marshal(settings)
+	if err != nil {
+		return Config{}, err
+	}
+	var conf Config
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(strict)
+	if err := decoder.Decode(&conf); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, err
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,165 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// HistoryTableSuffix is appended to the tracking table name to form the
+// append-only table recording every action taken on a migration.
+const HistoryTableSuffix = "_history"
+
+// HistoryAction is the kind of action recorded in the history table.
+type HistoryAction string
+
+const (
+	// HistoryUp records applying the Up section of a versioned or repeatable migration.
+	HistoryUp HistoryAction = "up"
+	// HistoryDown records applying the Down section of a migration.
+	HistoryDown HistoryAction = "down"
+	// HistoryBaseline records a baseline written by Squash or adopted by ApplyUp.
+	HistoryBaseline HistoryAction = "baseline"
+	// HistoryCompensate records undoing a migration that failed halfway.
+	HistoryCompensate HistoryAction = "compensate"
+)
+
+// Outcomes of a HistoryEntry.
+const (
+	HistorySucceeded = "succeeded"
+	HistoryFailed    = "failed"
+)
+
+const (
+	createHistoryTableQueryTemplate = `CREATE TABLE IF NOT EXISTS %s (migration_id TEXT, event_id TIMEUUID, recorded_at TIMESTAMP, action TEXT, username TEXT, hostname TEXT, checksum TEXT, duration_ms BIGINT, outcome TEXT, error TEXT, PRIMARY KEY (migration_id, event_id));`
+	insertHistoryQueryTemplate      = `INSERT INTO %s (migration_id, event_id, recorded_at, action, username, hostname, checksum, duration_ms, outcome, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	selectHistoryQueryTemplate      = `SELECT migration_id, recorded_at, action, username, hostname, checksum, duration_ms, outcome, error FROM %s;`
+)
+
+// HistoryEntry is one recorded action on a migration. Unlike the tracking
+// table, the history table is never updated or deleted from, so a reverted
+// migration keeps its up and down entries.
+type HistoryEntry struct {
+	MigrationID string
+	Action      HistoryAction
+	RecordedAt  time.Time
+	// User and Host identify who ran the action.
+	User string
+	Host string
+	// Checksum is the SHA-256 of the migration file at the time of the action.
+	Checksum string
+	Duration time.Duration
+	// Outcome is HistorySucceeded or HistoryFailed, with the failure in Error.
+	Outcome string
+	Error   string
+}
+
+// HistoryFilter selects history entries. Zero fields match every entry.
+type HistoryFilter struct {
+	MigrationID string
+	// Since and Until bound RecordedAt, inclusive.
+	Since time.Time
+	Until time.Time
+}
+
+func (f HistoryFilter) matches(entry HistoryEntry) bool {
+	return (f.MigrationID == "" || entry.MigrationID == f.MigrationID) &&
+		(f.Since.IsZero() || !entry.RecordedAt.Before(f.Since)) &&
+		(f.Until.IsZero() || !entry.RecordedAt.After(f.Until))
+}
+
+// HistoryTable returns the quoted name of the history table, next to
+// Config.TrackingTable.
+func (c Config) HistoryTable() string {
+	if c.MigrationTable == "" {
+		c.MigrationTable = c.Keyspace + DefaultMigrationTableSuffix
+	}
+	c.MigrationTable += HistoryTableSuffix
+	return c.TrackingTable()
+}
+
+// GetHistory returns the history entries matching filter, oldest first. The
+// history is empty when the history table does not exist yet.
+func GetHistory(conf Config, filter HistoryFilter) ([]HistoryEntry, error) {
+	return GetHistoryContext(context.Background(), conf, filter)
+}
+
+// GetHistoryContext is GetHistory with a context for query cancellation.
+func GetHistoryContext(ctx context.Context, conf Config, filter HistoryFilter) ([]HistoryEntry, error) {
+	session, err := openSession(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	entries := make([]HistoryEntry, 0)
+	iter := session.Iter(ctx, fmt.Sprintf(selectHistoryQueryTemplate, conf.HistoryTable()))
+	var entry HistoryEntry
+	var action string
+	var durationMS int64
+	for iter.Scan(&entry.MigrationID, &entry.RecordedAt, &action, &entry.User, &entry.Host, &entry.Checksum, &durationMS, &entry.Outcome, &entry.Error) {
+		entry.Action = HistoryAction(action)
+		entry.Duration = time.Duration(durationMS) * time.Millisecond
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+		entry = HistoryEntry{}
+	}
+	err = iter.Close()
+	if isMissingTableError(err) {
+		return []HistoryEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(entries, func(left, right HistoryEntry) int {
+		return left.RecordedAt.Compare(right.RecordedAt)
+	})
+
+	return entries, nil
+}
+
+// historyRecorder appends entries to the history table of a run.
+type historyRecorder struct {
+	conf      Config
+	execQuery queryExecutor
+	user      string
+	host      string
+}
+
+// newHistoryRecorder creates the history table when it does not exist.
+func newHistoryRecorder(conf Config, execQuery queryExecutor) (historyRecorder, error) {
+	if err := execQuery(fmt.Sprintf(createHistoryTableQueryTemplate, conf.HistoryTable())); err != nil {
+		return historyRecorder{}, err
+	}
+	host, _ := os.Hostname()
+
+	return historyRecorder{conf: conf, execQuery: execQuery, user: currentUsername(), host: host}, nil
+}
+
+// record appends an entry for an action that ended with err. A failing
+// insert is logged but not returned, as the action itself already happened
+// and the tracking table reflects it.
+func (h historyRecorder) record(migrationID string, action HistoryAction, checksum string, duration time.Duration, err error) {
+	outcome, message := HistorySucceeded, ""
+	if err != nil {
+		outcome, message = HistoryFailed, err.Error()
+	}
+	insertErr := h.execQuery(fmt.Sprintf(insertHistoryQueryTemplate, h.conf.HistoryTable()),
+		migrationID, gocql.TimeUUID(), time.Now().UTC(), string(action), h.user, h.host, checksum, duration.Milliseconds(), outcome, message)
+	if insertErr != nil {
+		h.conf.logger().Error("recording history failed", "migration", migrationID, "action", action, "error", insertErr)
+	}
+}
+
+// checksum returns the hex encoded SHA-256 of a migration file.
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,24 @@
+package migrate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryFilter(t *testing.T) {
+	at := time.Date(2026, 4, 22, 12, 0, 0, 0, time.UTC)
+	entry := HistoryEntry{MigrationID: "0001-create-users.cql", RecordedAt: at}
+
+	assert.True(t, HistoryFilter{}.matches(entry))
+	assert.True(t, HistoryFilter{MigrationID: "0001-create-users.cql", Since: at, Until: at}.matches(entry))
+	assert.False(t, HistoryFilter{MigrationID: "0002-create-orders.cql"}.matches(entry))
+	assert.False(t, HistoryFilter{Since: at.Add(time.Second)}.matches(entry))
+	assert.False(t, HistoryFilter{Until: at.Add(-time.Second)}.matches(entry))
+}
+
+func TestConfig_HistoryTable(t *testing.T) {
+	assert.Equal(t, `"bloodlab_migrations_history"`, Config{Keyspace: "bloodlab"}.HistoryTable())
+	assert.Equal(t, `"meta"."schema_history"`, Config{Keyspace: "bloodlab", MigrationKeyspace: "meta", MigrationTable: "schema"}.HistoryTable())
+}
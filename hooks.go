@@ -0,0 +1,158 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Direction tells whether migrations are applied or rolled back.
+type Direction string
+
+const (
+	DirectionUp   Direction = "up"
+	DirectionDown Direction = "down"
+)
+
+// HookEvent identifies the point in a run at which a hook is invoked.
+type HookEvent string
+
+const (
+	HookBeforeRun       HookEvent = "before_run"
+	HookBeforeMigration HookEvent = "before_migration"
+	HookAfterMigration  HookEvent = "after_migration"
+	HookAfterRun        HookEvent = "after_run"
+	HookOnError         HookEvent = "on_error"
+)
+
+// HookContext describes the run or migration a hook is invoked for.
+type HookContext struct {
+	Event       HookEvent
+	Direction   Direction
+	Environment string
+	Keyspace    string
+	// MigrationID is empty for run hooks.
+	MigrationID string
+	// Err is set for HookOnError and for HookAfterRun after a failed run.
+	Err error
+}
+
+// HookFunc is a library callback. An error returned from a before hook aborts
+// the run before the migration is applied.
+type HookFunc func(HookContext) error
+
+// Hooks are library callbacks invoked around ApplyUp and ApplyDown. Hooks
+// only run when there is at least one migration to apply. AfterRun is invoked
+// whenever BeforeRun succeeded, also after a failed run.
+type Hooks struct {
+	BeforeRun       HookFunc
+	BeforeMigration HookFunc
+	AfterMigration  HookFunc
+	AfterRun        HookFunc
+	OnError         HookFunc
+}
+
+// ShellHooks are shell commands run with "sh -c" around ApplyUp and
+// ApplyDown, after the matching library callback. The commands get
+// MIGRATION_ID, MIGRATION_DIRECTION, MIGRATION_ENVIRONMENT,
+// MIGRATION_KEYSPACE and, on errors, MIGRATION_ERROR as environment variables.
+type ShellHooks struct {
+	BeforeRun       []string `yaml:"before_run,omitempty"`
+	BeforeMigration []string `yaml:"before_migration,omitempty"`
+	AfterMigration  []string `yaml:"after_migration,omitempty"`
+	AfterRun        []string `yaml:"after_run,omitempty"`
+	OnError         []string `yaml:"on_error,omitempty"`
+}
+
+type hookRunner struct {
+	conf      Config
+	direction Direction
+}
+
+func newHookRunner(conf Config, direction Direction) hookRunner {
+	return hookRunner{conf: conf, direction: direction}
+}
+
+func (h hookRunner) beforeRun() error {
+	return h.run(HookBeforeRun, "", nil)
+}
+
+func (h hookRunner) beforeMigration(migrationID string) error {
+	return h.run(HookBeforeMigration, migrationID, nil)
+}
+
+func (h hookRunner) afterMigration(migrationID string) error {
+	return h.run(HookAfterMigration, migrationID, nil)
+}
+
+// finishRun invokes the error hooks for a failed run and the after run hooks,
+// and returns runErr joined with any hook failures.
+func (h hookRunner) finishRun(migrationID string, runErr error) error {
+	if runErr != nil {
+		if err := h.run(HookOnError, migrationID, runErr); err != nil {
+			runErr = errors.Join(runErr, err)
+		}
+	}
+	if err := h.run(HookAfterRun, "", runErr); err != nil {
+		return errors.Join(runErr, err)
+	}
+
+	return runErr
+}
+
+func (h hookRunner) run(event HookEvent, migrationID string, runErr error) error {
+	ctx := HookContext{
+		Event:       event,
+		Direction:   h.direction,
+		Environment: h.conf.Environment,
+		Keyspace:    h.conf.Keyspace,
+		MigrationID: migrationID,
+		Err:         runErr,
+	}
+	var callback HookFunc
+	var commands []string
+	switch event {
+	case HookBeforeRun:
+		callback, commands = h.conf.Hooks.BeforeRun, h.conf.ShellHooks.BeforeRun
+	case HookBeforeMigration:
+		callback, commands = h.conf.Hooks.BeforeMigration, h.conf.ShellHooks.BeforeMigration
+	case HookAfterMigration:
+		callback, commands = h.conf.Hooks.AfterMigration, h.conf.ShellHooks.AfterMigration
+	case HookAfterRun:
+		callback, commands = h.conf.Hooks.AfterRun, h.conf.ShellHooks.AfterRun
+	case HookOnError:
+		callback, commands = h.conf.Hooks.OnError, h.conf.ShellHooks.OnError
+	}
+
+	if callback != nil {
+		if err := callback(ctx); err != nil {
+			return fmt.Errorf("%s hook failed: %w", event, err)
+		}
+	}
+	for _, command := range commands {
+		if err := runShellHook(command, ctx); err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", event, command, err)
+		}
+	}
+
+	return nil
+}
+
+func runShellHook(command string, ctx HookContext) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"MIGRATION_ID="+ctx.MigrationID,
+		"MIGRATION_DIRECTION="+string(ctx.Direction),
+		"MIGRATION_ENVIRONMENT="+ctx.Environment,
+		"MIGRATION_KEYSPACE="+ctx.Keyspace,
+	)
+	if ctx.Err != nil {
+		cmd.Env = append(cmd.Env, "MIGRATION_ERROR="+ctx.Err.Error())
+	}
+	// hook output goes to stderr so it never mixes with command results on stdout
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
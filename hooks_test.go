@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookRunner_InvokesCallbacksWithContext(t *testing.T) {
+	contexts := make([]HookContext, 0)
+	record := func(ctx HookContext) error {
+		contexts = append(contexts, ctx)
+		return nil
+	}
+	conf := Config{
+		Keyspace:    "bloodlab",
+		Environment: "staging",
+		Hooks: Hooks{
+			BeforeRun:       record,
+			BeforeMigration: record,
+			AfterMigration:  record,
+			AfterRun:        record,
+			OnError:         record,
+		},
+	}
+	hooks := newHookRunner(conf, DirectionUp)
+
+	require.NoError(t, hooks.beforeRun())
+	require.NoError(t, hooks.beforeMigration("20260422123000-create-users.cql"))
+	require.NoError(t, hooks.afterMigration("20260422123000-create-users.cql"))
+	require.NoError(t, hooks.finishRun("", nil))
+
+	require.Len(t, contexts, 4)
+	assert.Equal(t, HookContext{Event: HookBeforeRun, Direction: DirectionUp, Environment: "staging", Keyspace: "bloodlab"}, contexts[0])
+	assert.Equal(t, HookBeforeMigration, contexts[1].Event)
+	assert.Equal(t, "20260422123000-create-users.cql", contexts[1].MigrationID)
+	assert.Equal(t, HookAfterMigration, contexts[2].Event)
+	assert.Equal(t, HookAfterRun, contexts[3].Event)
+	assert.Empty(t, contexts[3].MigrationID)
+}
+
+func TestHookRunner_FinishRunAfterFailure(t *testing.T) {
+	runErr := errors.New("statement failed")
+	events := make([]HookContext, 0)
+	record := func(ctx HookContext) error {
+		events = append(events, ctx)
+		return nil
+	}
+	hooks := newHookRunner(Config{Hooks: Hooks{OnError: record, AfterRun: record}}, DirectionDown)
+
+	err := hooks.finishRun("20260422123000-create-users.cql", runErr)
+	require.Error(t, err)
+	assert.Equal(t, runErr, err)
+
+	require.Len(t, events, 2)
+	assert.Equal(t, HookOnError, events[0].Event)
+	assert.Equal(t, "20260422123000-create-users.cql", events[0].MigrationID)
+	assert.Equal(t, runErr, events[0].Err)
+	assert.Equal(t, HookAfterRun, events[1].Event)
+	assert.Equal(t, runErr, events[1].Err)
+}
+
+func TestHookRunner_FailingBeforeHook(t *testing.T) {
+	hooks := newHookRunner(Config{Hooks: Hooks{
+		BeforeMigration: func(HookContext) error {
+			return errors.New("pipeline still running")
+		},
+	}}, DirectionUp)
+
+	err := hooks.beforeMigration("20260422123000-create-users.cql")
+	require.Error(t, err)
+	assert.Equal(t, "before_migration hook failed: pipeline still running", err.Error())
+}
+
+func TestHookRunner_ShellHookEnvironment(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "hook.out")
+	conf := Config{
+		Keyspace:    "bloodlab",
+		Environment: "staging",
+		ShellHooks: ShellHooks{
+			AfterMigration: []string{`echo "$MIGRATION_ID $MIGRATION_DIRECTION $MIGRATION_ENVIRONMENT $MIGRATION_KEYSPACE" > ` + output},
+		},
+	}
+
+	require.NoError(t, newHookRunner(conf, DirectionDown).afterMigration("20260422123000-create-users.cql"))
+
+	content, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "20260422123000-create-users.cql down staging bloodlab", strings.TrimSpace(string(content)))
+}
+
+func TestHookRunner_FailingShellHook(t *testing.T) {
+	conf := Config{ShellHooks: ShellHooks{BeforeRun: []string{"exit 3"}}}
+
+	err := newHookRunner(conf, DirectionUp).beforeRun()
+	require.Error(t, err)
+	assert.Equal(t, `before_run hook "exit 3" failed: exit status 3`, err.Error())
+}
+
+func TestGetConfigFrom_ShellHooks(t *testing.T) {
+	configFile := writeConfigFile(t, `
+development:
+  development: true
+  keyspace: bloodlab
+  connection:
+    hosts:
+      - 127.0.0.1
+  hooks:
+    before_run:
+      - ./pause-pipeline.sh
+    after_migration:
+      - notify "$MIGRATION_ID"
+`)
+
+	conf, err := GetConfigWithOptions(Options{ConfigFile: configFile, Environment: "development", Strict: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"./pause-pipeline.sh"}, conf.ShellHooks.BeforeRun)
+	assert.Equal(t, []string{`notify "$MIGRATION_ID"`}, conf.ShellHooks.AfterMigration)
+}
@@ -0,0 +1,297 @@
+// Package migratetest provides an in-memory fake Cassandra session for
+// testing migrations without a cluster.
+//
+// Set it as migrate.Config.Session to run ApplyUp, ApplyDown, GetStatus and
+// Squash against it. The fake records every statement, keeps the tracking
+// tables in memory and fails statements with scripted errors. Migration
+// statements themselves are only recorded, not interpreted.
+package migratetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	migrate "github.com/blutspende/cassandra-migrate"
+)
+
+var (
+	insertPattern = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+(\S+)\s*\(([^)]*)\)\s*VALUES`)
+	selectPattern = regexp.MustCompile(`(?is)^\s*SELECT\s+(.+?)\s+FROM\s+(\S+?)\s*;?\s*$`)
+	deletePattern = regexp.MustCompile(`(?is)^\s*DELETE\s+FROM\s+(\S+)\s+WHERE\s+id\s*=\s*\?`)
+)
+
+// Statement is one statement executed on a Session.
+type Statement struct {
+	Statement string
+	Args      []any
+}
+
+type row map[string]any
+
+type scriptedError struct {
+	match string
+	err   error
+	times int
+}
+
+// Session is an in-memory fake of a Cassandra session, safe for concurrent
+// use. The zero value is not usable, create one with NewSession.
+type Session struct {
+	mu         sync.Mutex
+	statements []Statement
+	tables     map[string][]row
+	errors     []*scriptedError
+	lastTime   time.Time
+	closed     bool
+}
+
+var _ migrate.Session = (*Session)(nil)
+
+// NewSession returns an empty fake session.
+func NewSession() *Session {
+	return &Session{tables: make(map[string][]row)}
+}
+
+// FailOn makes every statement containing match fail with err. Earlier
+// scripted errors take precedence.
+func (s *Session) FailOn(match string, err error) {
+	s.FailTimes(match, err, -1)
+}
+
+// FailTimes makes the next times statements containing match fail with err.
+func (s *Session) FailTimes(match string, err error, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors = append(s.errors, &scriptedError{match: match, err: err, times: times})
+}
+
+// MarkApplied records ids in the tracking table, as returned by
+// migrate.Config.TrackingTable, without executing anything.
+func (s *Session) MarkApplied(table string, ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.upsert(table, row{"id": id, "applied_at": s.now()})
+	}
+}
+
+// Applied returns the IDs recorded in table in version order.
+func (s *Session) Applied(table string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.tables[table]))
+	for _, r := range s.tables[table] {
+		if id, ok := r["id"].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, migrate.CompareMigrationIDs)
+
+	return ids
+}
+
+// Statements returns the executed statements in order, including failed ones.
+func (s *Session) Statements() []Statement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.statements)
+}
+
+// Closed reports whether Close was called.
+func (s *Session) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Exec records statement and updates the in-memory tables for INSERT and
+// DELETE statements with bind arguments, which is how tracking rows are written.
+func (s *Session) Exec(_ context.Context, statement string, args ...any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statements = append(s.statements, Statement{Statement: statement, Args: args})
+	if err := s.scriptedError(statement); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	if match := insertPattern.FindStringSubmatch(statement); match != nil {
+		r := row{}
+		for i, column := range strings.Split(match[2], ",") {
+			column = strings.TrimSpace(column)
+			switch {
+			case i < len(args):
+				r[column] = args[i]
+			case column == "applied_at":
+				r[column] = s.now()
+			}
+		}
+		s.upsert(match[1], r)
+		return nil
+	}
+	if match := deletePattern.FindStringSubmatch(statement); match != nil {
+		s.tables[match[1]] = slices.DeleteFunc(s.tables[match[1]], func(r row) bool {
+			return r["id"] == args[0]
+		})
+	}
+
+	return nil
+}
+
+// Iter records statement and returns the rows of the selected table. Only
+// plain "SELECT columns FROM table" statements are supported.
+func (s *Session) Iter(_ context.Context, statement string, args ...any) migrate.Iter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statements = append(s.statements, Statement{Statement: statement, Args: args})
+	if err := s.scriptedError(statement); err != nil {
+		return &iter{err: err}
+	}
+	match := selectPattern.FindStringSubmatch(statement)
+	if match == nil {
+		return &iter{err: fmt.Errorf("migratetest: unsupported query %q", statement)}
+	}
+	columns := strings.Split(match[1], ",")
+	rows := make([][]any, 0, len(s.tables[match[2]]))
+	for _, r := range s.tables[match[2]] {
+		values := make([]any, len(columns))
+		for i, column := range columns {
+			values[i] = r[strings.TrimSpace(column)]
+		}
+		rows = append(rows, values)
+	}
+
+	return &iter{rows: rows}
+}
+
+// Close marks the session closed. The tables are kept.
+func (s *Session) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+}
+
+func (s *Session) scriptedError(statement string) error {
+	for _, scripted := range s.errors {
+		if scripted.times == 0 || !strings.Contains(statement, scripted.match) {
+			continue
+		}
+		if scripted.times > 0 {
+			scripted.times--
+		}
+		return scripted.err
+	}
+
+	return nil
+}
+
+// upsert replaces the row with the same id, like an INSERT into a table
+// keyed by id. Rows without an id, such as history entries, are appended.
+func (s *Session) upsert(table string, r row) {
+	if _, ok := r["id"]; !ok {
+		s.tables[table] = append(s.tables[table], r)
+		return
+	}
+	index := slices.IndexFunc(s.tables[table], func(existing row) bool {
+		return existing["id"] == r["id"]
+	})
+	if index < 0 {
+		s.tables[table] = append(s.tables[table], r)
+		return
+	}
+	s.tables[table][index] = r
+}
+
+// now returns a strictly increasing millisecond timestamp, so the applied_at
+// order matches the order of execution like on a real cluster.
+func (s *Session) now() time.Time {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !now.After(s.lastTime) {
+		now = s.lastTime.Add(time.Millisecond)
+	}
+	s.lastTime = now
+
+	return now
+}
+
+type iter struct {
+	rows [][]any
+	err  error
+}
+
+func (i *iter) Scan(dest ...any) bool {
+	if i.err != nil || len(i.rows) == 0 {
+		return false
+	}
+	values := i.rows[0]
+	i.rows = i.rows[1:]
+	for index := range dest {
+		if index >= len(values) || values[index] == nil {
+			continue
+		}
+		target := reflect.ValueOf(dest[index]).Elem()
+		value := reflect.ValueOf(values[index])
+		if !value.Type().AssignableTo(target.Type()) {
+			i.err = fmt.Errorf("migratetest: cannot scan %T into %T", values[index], dest[index])
+			return false
+		}
+		target.Set(value)
+	}
+
+	return true
+}
+
+func (i *iter) Close() error {
+	return i.err
+}
+
+// RequestError is a scripted Cassandra error. It implements gocql.RequestError,
+// so migrate.IsExistError recognizes AlreadyExists errors.
+type RequestError struct {
+	ErrCode int
+	Msg     string
+}
+
+var _ gocql.RequestError = RequestError{}
+
+func (e RequestError) Code() int {
+	return e.ErrCode
+}
+
+func (e RequestError) Message() string {
+	return e.Msg
+}
+
+func (e RequestError) Error() string {
+	return e.Msg
+}
+
+// AlreadyExists returns an "already exists" error as returned for an
+// existing keyspace, table or type.
+func AlreadyExists(message string) error {
+	return RequestError{ErrCode: gocql.ErrCodeAlreadyExists, Msg: message}
+}
+
+// Timeout returns a write timeout error.
+func Timeout(message string) error {
+	return RequestError{ErrCode: gocql.ErrCodeWriteTimeout, Msg: message}
+}
+
+// SyntaxError returns a CQL syntax error.
+func SyntaxError(message string) error {
+	return RequestError{ErrCode: gocql.ErrCodeSyntax, Msg: message}
+}
+
+// MissingTable returns the error Cassandra returns for a query on a table
+// that does not exist.
+func MissingTable(table string) error {
+	return RequestError{ErrCode: gocql.ErrCodeInvalid, Msg: "unconfigured table " + table}
+}
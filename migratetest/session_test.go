@@ -0,0 +1,424 @@
+package migratetest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	migrate "github.com/blutspende/cassandra-migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeMigrations(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o666))
+	}
+	return dir
+}
+
+func TestSession_ApplyUpAndDown(t *testing.T) {
+	session := NewSession()
+	conf := migrate.Config{
+		Keyspace: "bloodlab",
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-create-users.cql":  "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n-- +migrate Down\nDROP TABLE users;\n",
+			"0002-create-orders.cql": "-- +migrate Up\nCREATE TABLE orders (id uuid PRIMARY KEY);\n-- +migrate Down\nDROP TABLE orders;\n",
+		}),
+		Session: session,
+	}
+
+	result, err := migrate.ApplyUp(conf)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0001-create-users.cql", "0002-create-orders.cql"}, result.AppliedMigrationIDs)
+	assert.Equal(t, []string{"0001-create-users.cql", "0002-create-orders.cql"}, session.Applied(conf.TrackingTable()))
+	assert.False(t, session.Closed())
+
+	down, err := migrate.ApplyDown(conf)
+	require.NoError(t, err)
+	assert.Equal(t, "0002-create-orders.cql", down.MigrationID)
+	assert.Equal(t, []string{"0001-create-users.cql"}, session.Applied(conf.TrackingTable()))
+
+	statements := make([]string, 0)
+	for _, statement := range session.Statements() {
+		statements = append(statements, statement.Statement)
+	}
+	assert.Contains(t, statements, "CREATE TABLE orders (id uuid PRIMARY KEY);\n")
+	assert.Contains(t, statements, "DROP TABLE orders;\n")
+
+	status, err := migrate.GetStatus(conf)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0002-create-orders.cql"}, status.Pending)
+}
+
+func TestSession_ScriptedErrors(t *testing.T) {
+	session := NewSession()
+	session.FailOn("CREATE TABLE users", AlreadyExists("table users already exists"))
+	session.FailTimes("CREATE TABLE orders", Timeout("write timeout"), 1)
+	conf := migrate.Config{
+		Keyspace: "bloodlab",
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-create-users.cql":  "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n",
+			"0002-create-orders.cql": "-- +migrate Up\nCREATE TABLE orders (id uuid PRIMARY KEY);\n",
+		}),
+		IgnoreExistErrors: true,
+		Session:           session,
+	}
+
+	result, err := migrate.ApplyUpContext(context.Background(), conf)
+	var migrationErr *migrate.MigrationError
+	require.True(t, errors.As(err, &migrationErr))
+	assert.Equal(t, "0002-create-orders.cql", migrationErr.MigrationID)
+	assert.Equal(t, []string{"0001-create-users.cql"}, result.AppliedMigrationIDs)
+
+	result, err = migrate.ApplyUp(conf)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0002-create-orders.cql"}, result.AppliedMigrationIDs)
+}
+
+func TestSession_MarkApplied(t *testing.T) {
+	session := NewSession()
+	conf := migrate.Config{
+		Keyspace: "bloodlab",
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-create-users.cql": "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n",
+		}),
+		Session: session,
+	}
+	session.MarkApplied(conf.TrackingTable(), "0001-create-users.cql")
+
+	result, err := migrate.ApplyUp(conf)
+	require.NoError(t, err)
+	assert.Zero(t, result.AppliedCount)
+	assert.NotContains(t, session.Statements(), Statement{Statement: "CREATE TABLE users (id uuid PRIMARY KEY);\n"})
+}
+
+func TestSession_SyntaxError(t *testing.T) {
+	session := NewSession()
+	session.FailOn("CREATE TABEL", SyntaxError("line 1:7 no viable alternative"))
+
+	err := session.Exec(context.Background(), "CREATE TABEL users (id uuid PRIMARY KEY);")
+	assert.False(t, migrate.IsExistError(err))
+	assert.EqualError(t, err, "line 1:7 no viable alternative")
+	assert.True(t, migrate.IsExistError(AlreadyExists("exists")))
+}
+
+func TestSession_History(t *testing.T) {
+	session := NewSession()
+	session.FailTimes("CREATE TABLE orders", Timeout("write timeout"), 1)
+	conf := migrate.Config{
+		Keyspace: "bloodlab",
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-create-users.cql":  "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n-- +migrate Down\nDROP TABLE users;\n",
+			"0002-create-orders.cql": "-- +migrate Up\nCREATE TABLE orders (id uuid PRIMARY KEY);\n-- +migrate Down\nDROP TABLE orders;\n",
+		}),
+		Session: session,
+	}
+
+	_, err := migrate.ApplyUp(conf)
+	require.Error(t, err)
+	_, err = migrate.ApplyUp(conf)
+	require.NoError(t, err)
+	_, err = migrate.ApplyDown(conf)
+	require.NoError(t, err)
+
+	history, err := migrate.GetHistory(conf, migrate.HistoryFilter{})
+	require.NoError(t, err)
+	require.Len(t, history, 4)
+	assert.Equal(t, "0001-create-users.cql", history[0].MigrationID)
+	assert.Equal(t, migrate.HistoryUp, history[0].Action)
+	assert.Equal(t, migrate.HistorySucceeded, history[0].Outcome)
+	assert.Len(t, history[0].Checksum, 64)
+	assert.Equal(t, migrate.HistoryFailed, history[1].Outcome)
+	assert.Contains(t, history[1].Error, "write timeout")
+	assert.Equal(t, migrate.HistoryDown, history[3].Action)
+	assert.Equal(t, "0002-create-orders.cql", history[3].MigrationID)
+	assert.Equal(t, []string{"0001-create-users.cql"}, session.Applied(conf.TrackingTable()))
+
+	orders, err := migrate.GetHistory(conf, migrate.HistoryFilter{MigrationID: "0002-create-orders.cql", Since: history[2].RecordedAt})
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	assert.Equal(t, []migrate.HistoryAction{migrate.HistoryUp, migrate.HistoryDown}, []migrate.HistoryAction{orders[0].Action, orders[1].Action})
+}
+
+func TestSession_ReadsWithoutCreatingTables(t *testing.T) {
+	session := NewSession()
+	conf := migrate.Config{
+		Keyspace: "bloodlab",
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-create-users.cql": "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n",
+			"R-views.cql":           "-- +migrate Up\nCREATE MATERIALIZED VIEW IF NOT EXISTS users_by_id AS SELECT id FROM users WHERE id IS NOT NULL PRIMARY KEY (id);\n",
+		}),
+		Session: session,
+	}
+	session.FailOn("FROM "+conf.TrackingTable()+";", MissingTable(conf.TrackingTable()))
+	session.FailOn("FROM "+conf.RepeatableTrackingTable()+";", MissingTable(conf.RepeatableTrackingTable()))
+	session.FailOn("FROM "+conf.HistoryTable()+";", MissingTable(conf.HistoryTable()))
+
+	status, err := migrate.GetStatus(conf)
+	require.NoError(t, err)
+	assert.Empty(t, status.Applied)
+	assert.Equal(t, []string{"0001-create-users.cql"}, status.Pending)
+	assert.Equal(t, []string{"R-views.cql"}, status.PendingRepeatable)
+
+	history, err := migrate.GetHistory(conf, migrate.HistoryFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	for _, statement := range session.Statements() {
+		assert.NotContains(t, statement.Statement, "CREATE TABLE")
+	}
+}
+
+func TestSession_ProtectedDown(t *testing.T) {
+	session := NewSession()
+	conf := migrate.Config{
+		Keyspace:    "bloodlab",
+		Environment: "production",
+		Protected:   true,
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-create-users.cql": "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n-- +migrate Down\nDROP TABLE users;\n",
+		}),
+		Session: session,
+	}
+	session.MarkApplied(conf.TrackingTable(), "0001-create-users.cql")
+
+	_, err := migrate.ApplyDown(conf)
+	require.ErrorIs(t, err, migrate.ErrConfirmationRequired)
+	assert.Equal(t, []string{"0001-create-users.cql"}, session.Applied(conf.TrackingTable()))
+
+	var planned []migrate.PlannedMigration
+	conf.Confirm = func(request migrate.ConfirmationRequest) error {
+		planned = request.Migrations
+		return nil
+	}
+	down, err := migrate.ApplyDown(conf)
+	require.NoError(t, err)
+	assert.True(t, down.Applied)
+	assert.Equal(t, []migrate.PlannedMigration{{ID: "0001-create-users.cql", Statements: []string{"DROP TABLE users;\n"}}}, planned)
+	assert.Empty(t, session.Applied(conf.TrackingTable()))
+}
+
+func TestSession_Compensate(t *testing.T) {
+	session := NewSession()
+	session.FailOn("CREATE TABLE orders", Timeout("write timeout"))
+	session.FailOn("DROP TYPE address", SyntaxError("type address is still in use"))
+	conf := migrate.Config{
+		Keyspace:          "bloodlab",
+		Compensate:        true,
+		IgnoreExistErrors: true,
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-create-schema.cql": `-- +migrate Up
+CREATE TYPE address (street text);
+-- +migrate Undo
+DROP TYPE address;
+CREATE TABLE users (id uuid PRIMARY KEY);
+-- +migrate Undo
+DROP TABLE users;
+CREATE TABLE samples (id uuid PRIMARY KEY);
+ALTER TABLE users ADD email text;
+CREATE TABLE orders (id uuid PRIMARY KEY);
+-- +migrate Down
+DROP TABLE orders;
+DROP TABLE samples;
+DROP TABLE users;
+DROP TYPE address;
+`,
+		}),
+		Session: session,
+	}
+	session.FailTimes("CREATE TABLE samples", AlreadyExists("table samples already exists"), 1)
+
+	result, err := migrate.ApplyUp(conf)
+	require.Error(t, err)
+	require.NotNil(t, result.Compensation)
+	assert.False(t, result.Compensation.Complete())
+	require.Len(t, result.Compensation.Undone, 1)
+	assert.Equal(t, "DROP TABLE users;\n", result.Compensation.Undone[0].Undo)
+	require.Len(t, result.Compensation.Remaining, 2)
+	assert.Equal(t, 3, result.Compensation.Remaining[0].Index)
+	assert.ErrorIs(t, result.Compensation.Remaining[0].Err, migrate.ErrNoUndo)
+	assert.Equal(t, 0, result.Compensation.Remaining[1].Index)
+	assert.EqualError(t, result.Compensation.Remaining[1].Err, "type address is still in use")
+	assert.Empty(t, session.Applied(conf.TrackingTable()))
+
+	history, err := migrate.GetHistory(conf, migrate.HistoryFilter{})
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, migrate.HistoryCompensate, history[1].Action)
+	assert.Equal(t, "2 of 3 applied statements not undone", history[1].Error)
+}
+
+func TestSession_CompensateIgnoresDown(t *testing.T) {
+	session := NewSession()
+	session.FailOn("CREATE TABLE orders", Timeout("write timeout"))
+	conf := migrate.Config{
+		Keyspace:   "bloodlab",
+		Compensate: true,
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-create-schema.cql": "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\nCREATE TABLE orders (id uuid PRIMARY KEY);\n-- +migrate Down\nDROP TABLE orders;\nDROP TABLE users;\n",
+		}),
+		Session: session,
+	}
+
+	result, err := migrate.ApplyUp(conf)
+	require.Error(t, err)
+	require.NotNil(t, result.Compensation)
+	assert.False(t, result.Compensation.Complete())
+	assert.Empty(t, result.Compensation.Undone)
+	assert.Equal(t, []migrate.CompensatedStatement{{Index: 0, Statement: "CREATE TABLE users (id uuid PRIMARY KEY);\n", Err: migrate.ErrNoUndo}}, result.Compensation.Remaining)
+	assert.NotContains(t, session.Statements(), Statement{Statement: "DROP TABLE users;\n"})
+
+	conf.Compensate = false
+	result, err = migrate.ApplyUp(conf)
+	require.Error(t, err)
+	assert.Nil(t, result.Compensation)
+}
+
+func TestSession_CompensateWithDown(t *testing.T) {
+	session := NewSession()
+	session.FailOn("CREATE TABLE orders", Timeout("write timeout"))
+	conf := migrate.Config{
+		Keyspace:   "bloodlab",
+		Compensate: true,
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-create-schema.cql": `-- +migrate CompensateWithDown
+-- +migrate Up
+CREATE TABLE users (id uuid PRIMARY KEY);
+CREATE TABLE samples (id uuid PRIMARY KEY);
+-- +migrate Undo
+TRUNCATE samples;
+CREATE TABLE orders (id uuid PRIMARY KEY);
+-- +migrate Down
+DROP TABLE orders;
+DROP TABLE samples;
+DROP TABLE users;
+`,
+		}),
+		Session: session,
+	}
+
+	result, err := migrate.ApplyUp(conf)
+	require.Error(t, err)
+	require.NotNil(t, result.Compensation)
+	assert.True(t, result.Compensation.Complete())
+	assert.Equal(t, []migrate.CompensatedStatement{
+		{Index: 1, Statement: "CREATE TABLE samples (id uuid PRIMARY KEY);\n", Undo: "TRUNCATE samples;\n"},
+		{Index: 0, Statement: "CREATE TABLE users (id uuid PRIMARY KEY);\n", Undo: "DROP TABLE users;\n"},
+	}, result.Compensation.Undone)
+	assert.NotContains(t, session.Statements(), Statement{Statement: "DROP TABLE orders;\n"})
+}
+
+func TestSession_DownAfterSquashRevertsLatestMigration(t *testing.T) {
+	session := NewSession()
+	conf := migrate.Config{
+		Keyspace: "ks",
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-a.cql": "-- +migrate Up\nCREATE TABLE a (id int PRIMARY KEY);\n-- +migrate Down\nDROP TABLE a;\n",
+			"0002-b.cql": "-- +migrate Up\nCREATE TABLE b (id int PRIMARY KEY);\n-- +migrate Down\nDROP TABLE b;\n",
+			"0003-c.cql": "-- +migrate Up\nCREATE TABLE c (id int PRIMARY KEY);\n-- +migrate Down\nDROP TABLE c;\n",
+		}),
+		Session: session,
+	}
+	_, err := migrate.ApplyUp(conf)
+	require.NoError(t, err)
+	_, err = migrate.Squash(conf, "0002-b.cql")
+	require.NoError(t, err)
+
+	down, err := migrate.ApplyDown(conf)
+	require.NoError(t, err)
+	assert.Equal(t, "0003-c.cql", down.MigrationID)
+	assert.Equal(t, []string{"0001-a.cql", "0002-b.cql", "0002-baseline.cql"}, session.Applied(conf.TrackingTable()))
+	statements := make([]string, 0)
+	for _, statement := range session.Statements() {
+		statements = append(statements, statement.Statement)
+	}
+	assert.Contains(t, statements, "DROP TABLE c;\n")
+	assert.NotContains(t, statements, "DROP TABLE ks.b;\n")
+
+	down, err = migrate.ApplyDown(conf)
+	require.NoError(t, err)
+	assert.Equal(t, "0002-baseline.cql", down.MigrationID)
+	assert.Empty(t, session.Applied(conf.TrackingTable()))
+}
+
+func TestSession_ScratchKeyspace(t *testing.T) {
+	session := NewSession()
+	conf := migrate.Config{
+		Keyspace:          "bloodlab",
+		MigrationKeyspace: "shared",
+		MigrationTable:    "bloodlab_migrations",
+		Protected:         true,
+		ShellHooks:        migrate.ShellHooks{BeforeRun: []string{"false"}},
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-create-users.cql": "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n",
+		}),
+	}
+	session.MarkApplied(conf.TrackingTable(), "0001-create-users.cql")
+	connects := 0
+	connect := func(migrate.Config) (migrate.Session, error) {
+		connects++
+		return session, nil
+	}
+
+	var name string
+	err := migrate.WithScratchKeyspace(conf, migrate.ScratchOptions{Connect: connect}, func(scratch migrate.ScratchKeyspace) error {
+		name = scratch.Name
+		assert.Equal(t, []string{"0001-create-users.cql"}, scratch.Up.AppliedMigrationIDs)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, connects)
+	assert.True(t, session.Closed())
+	assert.Equal(t, []string{"0001-create-users.cql"}, session.Applied(`"`+name+`_migrations"`))
+	assert.Equal(t, []string{"0001-create-users.cql"}, session.Applied(conf.TrackingTable()))
+	assert.Empty(t, session.Applied(conf.HistoryTable()))
+	statements := session.Statements()
+	assert.Equal(t, "DROP KEYSPACE IF EXISTS "+name, statements[len(statements)-1].Statement)
+}
+
+func TestSession_ScratchKeyspaceDroppedOnFailure(t *testing.T) {
+	session := NewSession()
+	session.FailOn("CREATE TABLE orders", Timeout("write timed out"))
+	conf := migrate.Config{
+		MigrationDir: writeMigrations(t, map[string]string{
+			"0001-create-users.cql":  "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n",
+			"0002-create-orders.cql": "-- +migrate Up\nCREATE TABLE orders (id uuid PRIMARY KEY);\n",
+		}),
+	}
+	opts := migrate.ScratchOptions{Connect: func(migrate.Config) (migrate.Session, error) {
+		return session, nil
+	}}
+	called := false
+
+	err := migrate.WithScratchKeyspace(conf, opts, func(migrate.ScratchKeyspace) error {
+		called = true
+		return nil
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "write timed out")
+	assert.False(t, called)
+	statements := session.Statements()
+	assert.Regexp(t, `^CREATE KEYSPACE scratch_\w+ WITH replication`, statements[0].Statement)
+	assert.Regexp(t, `^DROP KEYSPACE IF EXISTS scratch_\w+$`, statements[len(statements)-1].Statement)
+
+	session = NewSession()
+	err = migrate.WithScratchKeyspace(migrate.Config{MigrationDir: t.TempDir()}, opts, func(migrate.ScratchKeyspace) error {
+		return errors.New("tests failed")
+	})
+	assert.EqualError(t, err, "tests failed")
+	statements = session.Statements()
+	assert.Regexp(t, `^DROP KEYSPACE IF EXISTS scratch_\w+$`, statements[len(statements)-1].Statement)
+
+	session = NewSession()
+	session.FailOn("DROP KEYSPACE", Timeout("drop timed out"))
+	err = migrate.WithScratchKeyspace(migrate.Config{MigrationDir: t.TempDir()}, opts, func(migrate.ScratchKeyspace) error {
+		return errors.New("tests failed")
+	})
+	assert.ErrorContains(t, err, "tests failed")
+	assert.ErrorContains(t, err, "dropping scratch keyspace")
+}
@@ -1,9 +1,11 @@
 package migrate
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
+	"os/user"
 	"path"
 	"regexp"
 	"strings"
@@ -13,13 +15,45 @@ import (
 
 var templateContent = `
 -- +migrate Up
-
+{{.Up}}
 -- +migrate Down
-`
+{{.Down}}`
 var tpl = template.Must(template.New("new_migration").Parse(templateContent))
 
-// CreateMigration creates a timestamped migration file in conf.MigrationDir.
+// MigrationOptions fills in a new migration beyond the file name.
+type MigrationOptions struct {
+	// Up and Down are inserted into the Up and Down sections.
+	Up   string
+	Down string
+	// Author defaults to the current OS user.
+	Author string
+	// Repeatable creates a repeatable migration named R-<name>.cql without
+	// a version prefix.
+	Repeatable bool
+}
+
+// MigrationTemplateData holds the variables available to migration templates.
+type MigrationTemplateData struct {
+	Keyspace string
+	// Name is the migration name as given, FileName the generated file name.
+	Name      string
+	FileName  string
+	Version   string
+	Timestamp time.Time
+	Author    string
+	Up        string
+	Down      string
+}
+
+// CreateMigration creates a migration file in conf.MigrationDir, prefixed
+// according to conf.Versioning.
 func CreateMigration(conf Config, name string) (string, error) {
+	return CreateMigrationWithOptions(conf, name, MigrationOptions{})
+}
+
+// CreateMigrationWithOptions creates a migration file like CreateMigration,
+// rendered from conf.MigrationTemplate when set.
+func CreateMigrationWithOptions(conf Config, name string, opts MigrationOptions) (string, error) {
 	if strings.TrimSpace(name) == "" {
 		return "", errors.New("missing migration name")
 	}
@@ -28,28 +62,113 @@ func CreateMigration(conf Config, name string) (string, error) {
 		return "", err
 	}
 
-	filePath := path.Join(conf.MigrationDir, generateFileName(name))
-	f, err := os.Create(filePath)
+	at := time.Now()
+	if conf.Versioning == VersioningUTC {
+		at = at.UTC()
+	}
+	fileName := RepeatablePrefix + sanitizeName(name) + ".cql"
+	version := ""
+	if !opts.Repeatable {
+		var err error
+		if fileName, err = generateFileName(conf, name, at); err != nil {
+			return "", err
+		}
+		version, _, _ = strings.Cut(fileName, "-")
+	}
+	migrationTemplate, err := loadMigrationTemplate(conf.MigrationTemplate)
+	if err != nil {
+		return "", err
+	}
+	data := MigrationTemplateData{
+		Keyspace:  conf.Keyspace,
+		Name:      strings.TrimSpace(name),
+		FileName:  fileName,
+		Version:   version,
+		Timestamp: at,
+		Author:    opts.Author,
+		Up:        sectionContent(opts.Up),
+		Down:      sectionContent(opts.Down),
+	}
+	if data.Author == "" {
+		data.Author = currentUsername()
+	}
+	var content bytes.Buffer
+	if err := migrationTemplate.Execute(&content, data); err != nil {
+		return "", fmt.Errorf("render migration template: %w", err)
+	}
+
+	filePath := path.Join(conf.MigrationDir, fileName)
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
 	if err != nil {
 		return "", err
 	}
 	defer func() { _ = f.Close() }()
 
-	if err := tpl.Execute(f, nil); err != nil {
+	if _, err := f.Write(content.Bytes()); err != nil {
 		return "", err
 	}
 
 	return filePath, nil
 }
 
+func loadMigrationTemplate(file string) (*template.Template, error) {
+	if file == "" {
+		return tpl, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("migration template: %w", err)
+	}
+	custom, err := template.New(path.Base(file)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("migration template: %w", err)
+	}
+
+	return custom, nil
+}
+
+// sectionContent trims CQL for a template section and ends it with a newline.
+func sectionContent(cql string) string {
+	cql = strings.TrimSpace(cql)
+	if cql == "" {
+		return ""
+	}
+	return cql + "\n"
+}
+
+func currentUsername() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
 var specialCharactersRegex = regexp.MustCompile("[^A-Za-z0-9]+")
 
-func generateFileName(filename string) string {
-	return GenerateFileName(filename, time.Now())
+func generateFileName(conf Config, filename string, at time.Time) (string, error) {
+	switch conf.Versioning {
+	case VersioningSequential:
+		version, err := nextSequentialVersion(conf.MigrationDir)
+		if err != nil {
+			return "", err
+		}
+		return GenerateSequentialFileName(filename, version), nil
+	default:
+		return GenerateFileName(filename, at), nil
+	}
 }
 
 // GenerateFileName returns a sanitized migration filename for a given timestamp.
 func GenerateFileName(filename string, at time.Time) string {
-	name := specialCharactersRegex.ReplaceAllString(strings.TrimSpace(filename), "-")
-	return fmt.Sprintf("%s-%s.cql", at.Format("20060102150405"), name)
+	return fmt.Sprintf("%s-%s.cql", at.Format(timestampVersionFormat), sanitizeName(filename))
+}
+
+// GenerateSequentialFileName returns a sanitized migration filename for a
+// sequential version, zero padded to four digits.
+func GenerateSequentialFileName(filename string, version uint64) string {
+	return fmt.Sprintf("%0*d-%s.cql", sequentialVersionWidth, version, sanitizeName(filename))
+}
+
+func sanitizeName(filename string) string {
+	return specialCharactersRegex.ReplaceAllString(strings.TrimSpace(filename), "-")
 }
@@ -1,6 +1,7 @@
 package migrate
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -24,7 +25,72 @@ func TestCreateMigration_CreatesTimestampedFileWithTemplate(t *testing.T) {
 
 	content, err := os.ReadFile(filePath)
 	require.NoError(t, err)
-	assert.Equal(t, templateContent, string(content))
+	assert.Equal(t, "\n-- +migrate Up\n\n-- +migrate Down\n", string(content))
+}
+
+func TestCreateMigrationWithOptions_FillsSections(t *testing.T) {
+	conf := Config{
+		MigrationDir: t.TempDir(),
+	}
+
+	filePath, err := CreateMigrationWithOptions(conf, "create users", MigrationOptions{
+		Up:   "CREATE TABLE users (id uuid PRIMARY KEY);\n",
+		Down: "  DROP TABLE users;",
+	})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "\n-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n\n-- +migrate Down\nDROP TABLE users;\n", string(content))
+}
+
+func TestCreateMigrationWithOptions_CustomTemplate(t *testing.T) {
+	tempDir := t.TempDir()
+	templateFile := filepath.Join(tempDir, "migration.tmpl")
+	require.NoError(t, os.WriteFile(templateFile, []byte(`-- {{.Name}} for {{.Keyspace}} by {{.Author}}, version {{.Version}} ({{.Timestamp.Year}})
+-- +migrate Up
+{{.Up}}
+-- +migrate Down
+{{.Down}}`), 0o644))
+	conf := Config{
+		Keyspace:          "bloodlab",
+		MigrationDir:      tempDir,
+		MigrationTemplate: templateFile,
+		Versioning:        VersioningSequential,
+	}
+
+	filePath, err := CreateMigrationWithOptions(conf, "create users", MigrationOptions{
+		Up:     "CREATE TABLE users (id uuid PRIMARY KEY);",
+		Author: "jane",
+	})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf(`-- create users for bloodlab by jane, version 0001 (%d)
+-- +migrate Up
+CREATE TABLE users (id uuid PRIMARY KEY);
+
+-- +migrate Down
+`, time.Now().Year()), string(content))
+}
+
+func TestCreateMigrationWithOptions_InvalidTemplate(t *testing.T) {
+	tempDir := t.TempDir()
+	templateFile := filepath.Join(tempDir, "migration.tmpl")
+	require.NoError(t, os.WriteFile(templateFile, []byte(`{{.Owner}}`), 0o644))
+	conf := Config{
+		MigrationDir:      tempDir,
+		MigrationTemplate: templateFile,
+	}
+
+	_, err := CreateMigration(conf, "create users")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "render migration template")
+
+	files, err := filepath.Glob(filepath.Join(tempDir, "*.cql"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
 }
 
 func TestCreateMigration_MissingName(t *testing.T) {
@@ -53,3 +119,67 @@ func TestGenerateFileName(t *testing.T) {
 	got := GenerateFileName(" create_user@table ", at)
 	assert.Equal(t, "20260306130542-create-user-table.cql", got)
 }
+
+func TestCreateMigration_SequentialVersioning(t *testing.T) {
+	tempDir := t.TempDir()
+	conf := Config{
+		MigrationDir: tempDir,
+		Versioning:   VersioningSequential,
+	}
+
+	filePath, err := CreateMigration(conf, "create users")
+	require.NoError(t, err)
+	assert.Equal(t, "0001-create-users.cql", filepath.Base(filePath))
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "0007-add-index.cql"), nil, 0o644))
+	filePath, err = CreateMigration(conf, "add email")
+	require.NoError(t, err)
+	assert.Equal(t, "0008-add-email.cql", filepath.Base(filePath))
+}
+
+func TestCreateMigration_SequentialVersioningRejectsTimestamps(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "20260306130542-create-users.cql"), nil, 0o644))
+	conf := Config{
+		MigrationDir: tempDir,
+		Versioning:   VersioningSequential,
+	}
+
+	_, err := CreateMigration(conf, "add email")
+	require.Error(t, err)
+	assert.Equal(t, "migration 20260306130542-create-users.cql has a timestamp version, sequential versioning cannot continue it", err.Error())
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestCreateMigration_UTCVersioning(t *testing.T) {
+	conf := Config{
+		MigrationDir: t.TempDir(),
+		Versioning:   VersioningUTC,
+	}
+
+	before := time.Now().UTC().Truncate(time.Second)
+	filePath, err := CreateMigration(conf, "create users")
+	require.NoError(t, err)
+
+	version, err := time.Parse("20060102150405", filepath.Base(filePath)[:14])
+	require.NoError(t, err)
+	assert.WithinDuration(t, before, version, 2*time.Second)
+}
+
+func TestGenerateSequentialFileName(t *testing.T) {
+	assert.Equal(t, "0012-create-user-table.cql", GenerateSequentialFileName(" create_user@table ", 12))
+	assert.Equal(t, "12345-create-user-table.cql", GenerateSequentialFileName("create user table", 12345))
+}
+
+func TestCreateMigrationWithOptions_Repeatable(t *testing.T) {
+	conf := Config{
+		MigrationDir: t.TempDir(),
+		Versioning:   VersioningSequential,
+	}
+
+	filePath, err := CreateMigrationWithOptions(conf, "user functions", MigrationOptions{Repeatable: true})
+	require.NoError(t, err)
+	assert.Equal(t, "R-user-functions.cql", filepath.Base(filePath))
+}
@@ -0,0 +1,77 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+var (
+	// ErrConfirmationRequired is returned for actions in a protected
+	// environment when Config.Confirm is nil.
+	ErrConfirmationRequired = errors.New("confirmation required")
+	// ErrNotConfirmed is returned by Config.Confirm implementations when the
+	// action was declined.
+	ErrNotConfirmed = errors.New("not confirmed")
+)
+
+// ConfirmationRequest is the plan of an action in a protected environment,
+// passed to Config.Confirm before anything is executed.
+type ConfirmationRequest struct {
+	Environment string
+	Direction   Direction
+	// Migrations holds the migrations that need confirmation in order: the
+	// reverted migration for DirectionDown, the pending dangerous migrations
+	// for DirectionUp.
+	Migrations []PlannedMigration
+}
+
+// PlannedMigration is one migration of a ConfirmationRequest.
+type PlannedMigration struct {
+	ID string
+	// Reason is the text of the '-- +migrate Dangerous' directive, if any.
+	Reason     string
+	Statements []string
+}
+
+// confirm asks conf.Confirm to approve request when conf is protected.
+func confirm(conf Config, request ConfirmationRequest) error {
+	if !conf.Protected || len(request.Migrations) == 0 {
+		return nil
+	}
+	if conf.Confirm == nil {
+		return fmt.Errorf("environment %s is protected: %w", conf.Environment, ErrConfirmationRequired)
+	}
+	if err := conf.Confirm(request); err != nil {
+		return err
+	}
+	conf.logger().Warn("confirmed action in protected environment", "environment", conf.Environment, "direction", request.Direction, "migrations", len(request.Migrations))
+
+	return nil
+}
+
+// confirmDangerousMigrations asks for confirmation of the pending migrations
+// marked with '-- +migrate Dangerous' that run statements in conf.Environment.
+func confirmDangerousMigrations(conf Config, files []string) error {
+	if !conf.Protected {
+		return nil
+	}
+	request := ConfirmationRequest{Environment: conf.Environment, Direction: DirectionUp}
+	for _, file := range files {
+		migration, err := parseMigrationFile(file)
+		if err != nil {
+			return err
+		}
+		statements := migration.UpStatementsFor(conf.Environment)
+		if !migration.Dangerous || len(statements) == 0 {
+			continue
+		}
+		request.Migrations = append(request.Migrations, PlannedMigration{
+			ID:         filepath.Base(file),
+			Reason:     migration.DangerousReason,
+			Statements: statements,
+		})
+	}
+
+	return confirm(conf, request)
+}
@@ -0,0 +1,43 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmDangerousMigrations(t *testing.T) {
+	tempDir := t.TempDir()
+	safe := writeMigrationFile(t, tempDir, "0001-create-users.cql", "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n")
+	dangerous := writeMigrationFile(t, tempDir, "0002-drop-orders.cql", "-- +migrate Dangerous drops the legacy orders table\n-- +migrate Up\nDROP TABLE orders;\n")
+	restricted := writeMigrationFile(t, tempDir, "0003-drop-seed.cql", "-- +migrate Dangerous\n-- +migrate Env development\n-- +migrate Up\nDROP TABLE seed;\n")
+	files := []string{safe, dangerous, restricted}
+
+	require.NoError(t, confirmDangerousMigrations(Config{Environment: "production"}, files))
+
+	conf := Config{Environment: "production", Protected: true}
+	err := confirmDangerousMigrations(conf, files)
+	assert.ErrorIs(t, err, ErrConfirmationRequired)
+	assert.EqualError(t, err, "environment production is protected: confirmation required")
+
+	var request ConfirmationRequest
+	conf.Confirm = func(r ConfirmationRequest) error {
+		request = r
+		return ErrNotConfirmed
+	}
+	assert.ErrorIs(t, confirmDangerousMigrations(conf, files), ErrNotConfirmed)
+	assert.Equal(t, ConfirmationRequest{
+		Environment: "production",
+		Direction:   DirectionUp,
+		Migrations: []PlannedMigration{{
+			ID:         "0002-drop-orders.cql",
+			Reason:     "drops the legacy orders table",
+			Statements: []string{"DROP TABLE orders;\n"},
+		}},
+	}, request)
+
+	conf.Confirm = func(ConfirmationRequest) error { return nil }
+	assert.NoError(t, confirmDangerousMigrations(conf, files))
+	assert.NoError(t, confirmDangerousMigrations(conf, []string{safe}))
+}
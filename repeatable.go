@@ -0,0 +1,134 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+const (
+	// RepeatablePrefix marks repeatable migration files, e.g. R-user-functions.cql.
+	// They are re-applied after the versioned migrations whenever their
+	// content changes.
+	RepeatablePrefix = "R-"
+	// RepeatableTableSuffix is appended to the tracking table name to form the
+	// table holding the checksums of applied repeatable migrations.
+	RepeatableTableSuffix = "_repeatable"
+)
+
+const (
+	createRepeatableTableQueryTemplate = `CREATE TABLE IF NOT EXISTS %s (id TEXT, checksum TEXT, applied_at TIMESTAMP, PRIMARY KEY(id));`
+	upsertRepeatableQueryTemplate      = `INSERT INTO %s (id, checksum, applied_at) VALUES (?, ?, toTimestamp(now()));`
+	selectRepeatableQueryTemplate      = `SELECT id, checksum FROM %s;`
+)
+
+// RepeatableTrackingTable returns the quoted name of the table tracking
+// repeatable migrations, next to Config.TrackingTable.
+func (c Config) RepeatableTrackingTable() string {
+	if c.MigrationTable == "" {
+		c.MigrationTable = c.Keyspace + DefaultMigrationTableSuffix
+	}
+	c.MigrationTable += RepeatableTableSuffix
+	return c.TrackingTable()
+}
+
+// IsRepeatableMigration reports whether id names a repeatable migration.
+func IsRepeatableMigration(id string) bool {
+	return strings.HasPrefix(id, RepeatablePrefix)
+}
+
+type repeatableMigration struct {
+	id       string
+	checksum string
+	content  []byte
+}
+
+// listRepeatableFiles returns the repeatable migration files of
+// conf.MigrationDir in name order.
+func listRepeatableFiles(conf Config) ([]string, error) {
+	return filepath.Glob(filepath.Join(conf.MigrationDir, RepeatablePrefix+"*.cql"))
+}
+
+// loadPendingRepeatables returns the repeatable migrations that were never
+// applied or changed since. The tracking table is only created when the
+// migration directory contains repeatable migrations and execQuery is not
+// nil. A missing tracking table counts as empty, so read-only callers such
+// as GetStatus pass a nil execQuery.
+func loadPendingRepeatables(ctx context.Context, conf Config, session Session, execQuery queryExecutor) ([]repeatableMigration, error) {
+	files, err := listRepeatableFiles(conf)
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	if execQuery != nil {
+		if err := execQuery(fmt.Sprintf(createRepeatableTableQueryTemplate, conf.RepeatableTrackingTable())); err != nil {
+			return nil, err
+		}
+	}
+	checksums, err := repeatableChecksums(ctx, session, conf.RepeatableTrackingTable())
+	if isMissingTableError(err) {
+		checksums, err = map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pendingRepeatables(files, checksums)
+}
+
+func pendingRepeatables(files []string, checksums map[string]string) ([]repeatableMigration, error) {
+	pending := make([]repeatableMigration, 0)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		repeatable := repeatableMigration{
+			id:       filepath.Base(file),
+			checksum: checksum(content),
+			content:  content,
+		}
+		if checksums[repeatable.id] != repeatable.checksum {
+			pending = append(pending, repeatable)
+		}
+	}
+
+	return pending, nil
+}
+
+func applyAndRecordRepeatable(ctx context.Context, conf Config, repeatable repeatableMigration, statements []string, execQuery queryExecutor) error {
+	if err := executeStatements(ctx, conf, repeatable.id, DirectionUp, statements, execQuery); err != nil {
+		return fmt.Errorf("failed to execute statement in %s: %w", repeatable.id, err)
+	}
+
+	if err := execQuery(fmt.Sprintf(upsertRepeatableQueryTemplate, conf.RepeatableTrackingTable()), repeatable.id, repeatable.checksum); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", repeatable.id, err)
+	}
+
+	return nil
+}
+
+// GetRepeatableChecksums returns the recorded checksum of every applied
+// repeatable migration in the given table, as returned by
+// Config.RepeatableTrackingTable.
+func GetRepeatableChecksums(table string, session *gocql.Session) (map[string]string, error) {
+	return repeatableChecksums(context.Background(), NewSession(session), table)
+}
+
+func repeatableChecksums(ctx context.Context, session Session, table string) (map[string]string, error) {
+	query := fmt.Sprintf(selectRepeatableQueryTemplate, table)
+	checksums := make(map[string]string)
+	iter := session.Iter(ctx, query)
+	var id, checksum string
+	for iter.Scan(&id, &checksum) {
+		checksums[id] = checksum
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return checksums, nil
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepeatableTrackingTable(t *testing.T) {
+	assert.Equal(t, `"bloodlab_migrations_repeatable"`, Config{Keyspace: "bloodlab"}.RepeatableTrackingTable())
+	assert.Equal(t, `"tracking"."schema_repeatable"`, Config{
+		Keyspace:          "bloodlab",
+		MigrationTable:    "schema",
+		MigrationKeyspace: "tracking",
+	}.RepeatableTrackingTable())
+}
+
+func TestPendingRepeatables(t *testing.T) {
+	tempDir := t.TempDir()
+	unchanged := writeMigrationFile(t, tempDir, "R-functions.cql", "-- +migrate Up\nCREATE OR REPLACE FUNCTION f() ...;\n")
+	changed := writeMigrationFile(t, tempDir, "R-views.cql", "-- +migrate Up\nCREATE MATERIALIZED VIEW v ...;\n")
+	added := writeMigrationFile(t, tempDir, "R-aggregates.cql", "-- +migrate Up\nCREATE AGGREGATE a ...;\n")
+	content, err := os.ReadFile(unchanged)
+	require.NoError(t, err)
+	sum := sha256.Sum256(content)
+
+	pending, err := pendingRepeatables([]string{added, unchanged, changed}, map[string]string{
+		"R-functions.cql": hex.EncodeToString(sum[:]),
+		"R-views.cql":     "outdated",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, pending, 2)
+	assert.Equal(t, "R-aggregates.cql", pending[0].id)
+	assert.Equal(t, "R-views.cql", pending[1].id)
+	assert.Len(t, pending[1].checksum, 64)
+}
+
+func TestApplyAndRecordRepeatable(t *testing.T) {
+	calls := make([]queryCall, 0)
+	err := applyAndRecordRepeatable(
+		context.Background(),
+		Config{Keyspace: "bloodlab"},
+		repeatableMigration{id: "R-functions.cql", checksum: "abc"},
+		[]string{"CREATE OR REPLACE FUNCTION f() ...;"},
+		func(statement string, args ...any) error {
+			calls = append(calls, queryCall{statement: statement, args: args})
+			return nil
+		},
+	)
+	require.NoError(t, err)
+
+	require.Len(t, calls, 2)
+	assert.Equal(t, "CREATE OR REPLACE FUNCTION f() ...;", calls[0].statement)
+	assert.Equal(t, fmt.Sprintf(upsertRepeatableQueryTemplate, `"bloodlab_migrations_repeatable"`), calls[1].statement)
+	assert.Equal(t, []any{"R-functions.cql", "abc"}, calls[1].args)
+}
+
+func TestApplyAndRecordRepeatable_DoesNotRecordWhenStatementFails(t *testing.T) {
+	calls := make([]queryCall, 0)
+	err := applyAndRecordRepeatable(
+		context.Background(),
+		Config{Keyspace: "bloodlab"},
+		repeatableMigration{id: "R-functions.cql", checksum: "abc"},
+		[]string{"CREATE OR REPLACE FUNCTION f() ...;"},
+		func(statement string, args ...any) error {
+			calls = append(calls, queryCall{statement: statement, args: args})
+			return errors.New("invalid function")
+		},
+	)
+	require.Error(t, err)
+	assert.Equal(t, "failed to execute statement in R-functions.cql: invalid function", err.Error())
+	assert.Len(t, calls, 1)
+}
+
+func TestListMigrationFiles_SkipsRepeatables(t *testing.T) {
+	tempDir := t.TempDir()
+	writeMigrationFile(t, tempDir, "0001-create-users.cql", "")
+	writeMigrationFile(t, tempDir, "R-functions.cql", "")
+
+	files, err := listMigrationFiles(Config{MigrationDir: tempDir})
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(tempDir, "0001-create-users.cql")}, files)
+
+	repeatables, err := listRepeatableFiles(Config{MigrationDir: tempDir})
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(tempDir, "R-functions.cql")}, repeatables)
+}
@@ -0,0 +1,384 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blutspende/cassandra-migrate/schema"
+)
+
+// RoundTripMigration is the round trip verification of one migration.
+type RoundTripMigration struct {
+	ID string
+	// Differences describes every schema element whose state after Up and
+	// Down differs from its state before Up. It is empty when Down exactly
+	// reverses Up.
+	Differences []string
+	// Err is the failing statement of Up or Down. Differences are only
+	// computed when both succeed.
+	Err error
+}
+
+// OK reports whether the Down section of the migration reverses its Up section.
+func (m RoundTripMigration) OK() bool {
+	return m.Err == nil && len(m.Differences) == 0
+}
+
+// RoundTripResult is the outcome of VerifyRoundTrip and VerifyRoundTripLive.
+type RoundTripResult struct {
+	// Migrations holds the verified migrations in order.
+	Migrations []RoundTripMigration
+}
+
+// Failed returns the migrations whose Down does not reverse their Up.
+func (r RoundTripResult) Failed() []RoundTripMigration {
+	failed := make([]RoundTripMigration, 0)
+	for _, migration := range r.Migrations {
+		if !migration.OK() {
+			failed = append(failed, migration)
+		}
+	}
+
+	return failed
+}
+
+// roundTripTarget is the schema a round trip verification runs against.
+type roundTripTarget interface {
+	// apply runs statements in order and returns the index and error of the
+	// first failing one.
+	apply(statements []string) (int, error)
+	// snapshot returns the definition of every schema element by kind and name.
+	snapshot() (map[string]string, error)
+	// saveUp is called after Up succeeded, restoreUp after Down ran, to
+	// continue with the schema after Up.
+	saveUp()
+	restoreUp(statements []string) error
+}
+
+// VerifyRoundTrip checks offline that the Down section of every migration in
+// conf.MigrationDir reverses its Up section. Starting from an empty schema
+// model of conf.Keyspace, each migration is applied up, the schema is
+// snapshotted, the migration is applied down and the result is compared to
+// the schema before Up. Verification then continues from the schema after Up.
+// Repeatable migrations have no Down section and are not verified.
+func VerifyRoundTrip(conf Config) (RoundTripResult, error) {
+	return verifyRoundTrip(conf, &offlineTarget{schema: schema.New(conf.Keyspace)})
+}
+
+// VerifyRoundTripLive is VerifyRoundTrip against conf.Keyspace on the
+// configured cluster, comparing snapshots of system_schema. The keyspace must
+// be empty, as the migrations are executed without tracking.
+func VerifyRoundTripLive(conf Config) (RoundTripResult, error) {
+	return VerifyRoundTripLiveContext(context.Background(), conf)
+}
+
+// VerifyRoundTripLiveContext is VerifyRoundTripLive with a context.
+func VerifyRoundTripLiveContext(ctx context.Context, conf Config) (RoundTripResult, error) {
+	session, err := openSession(conf)
+	if err != nil {
+		return RoundTripResult{}, err
+	}
+	defer session.Close()
+	target := &liveTarget{ctx: ctx, session: session, keyspace: conf.Keyspace}
+	initial, err := target.snapshot()
+	if err != nil {
+		return RoundTripResult{}, err
+	}
+	if len(initial) > 0 {
+		return RoundTripResult{}, fmt.Errorf("keyspace %s is not empty, live round trip verification needs a scratch keyspace", conf.Keyspace)
+	}
+
+	return verifyRoundTrip(conf, target)
+}
+
+func verifyRoundTrip(conf Config, target roundTripTarget) (RoundTripResult, error) {
+	migrationFiles, err := listMigrationFiles(conf)
+	if err != nil {
+		return RoundTripResult{}, err
+	}
+	logger := conf.logger()
+	result := RoundTripResult{Migrations: make([]RoundTripMigration, 0, len(migrationFiles))}
+	for _, file := range migrationFiles {
+		id := filepath.Base(file)
+		migration, err := parseMigrationFile(file)
+		if err != nil {
+			return result, err
+		}
+		up, down := migration.UpStatementsFor(conf.Environment), migration.DownStatementsFor(conf.Environment)
+		verified := RoundTripMigration{ID: id}
+		before, err := target.snapshot()
+		if err != nil {
+			return result, err
+		}
+		if index, err := target.apply(up); err != nil {
+			verified.Err = &SimulationError{MigrationID: id, Direction: DirectionUp, Line: migration.UpLines[index], Statement: up[index], Err: err}
+			logger.Warn("round trip failed", "migration", id, "direction", DirectionUp, "error", err)
+			result.Migrations = append(result.Migrations, verified)
+			continue
+		}
+		target.saveUp()
+		if index, err := target.apply(down); err != nil {
+			verified.Err = &SimulationError{MigrationID: id, Direction: DirectionDown, Line: migration.DownLines[index], Statement: down[index], Err: err}
+		} else {
+			reverted, err := target.snapshot()
+			if err != nil {
+				return result, err
+			}
+			verified.Differences = diffSnapshots(before, reverted)
+		}
+		result.Migrations = append(result.Migrations, verified)
+		if verified.OK() {
+			logger.Info("round trip verified", "migration", id)
+		} else {
+			logger.Warn("round trip failed", "migration", id, "differences", len(verified.Differences), "error", verified.Err)
+		}
+		if err := target.restoreUp(up); err != nil {
+			return result, fmt.Errorf("cannot continue after round trip of %s: %w", id, err)
+		}
+	}
+
+	return result, nil
+}
+
+// diffSnapshots describes the elements of reverted that differ from before.
+func diffSnapshots(before, reverted map[string]string) []string {
+	keys := make([]string, 0, len(before)+len(reverted))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range reverted {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	differences := make([]string, 0)
+	for _, key := range keys {
+		expected, existed := before[key]
+		actual, exists := reverted[key]
+		switch {
+		case !existed:
+			differences = append(differences, key+" is left behind by Down")
+		case !exists:
+			differences = append(differences, key+" is missing after Down")
+		case expected != actual:
+			extra, missing := diffLines(expected, actual)
+			difference := key + " differs after Down"
+			if len(extra) > 0 {
+				difference += ", has " + strings.Join(extra, "; ")
+			}
+			if len(missing) > 0 {
+				difference += ", lacks " + strings.Join(missing, "; ")
+			}
+			differences = append(differences, difference)
+		}
+	}
+
+	return differences
+}
+
+// diffLines returns the lines only in actual and the lines only in expected.
+func diffLines(expected, actual string) ([]string, []string) {
+	split := func(definition string) []string {
+		lines := make([]string, 0)
+		for _, line := range strings.Split(definition, "\n") {
+			if line = strings.TrimSuffix(strings.TrimSpace(line), ","); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+	expectedLines, actualLines := split(expected), split(actual)
+	extra := make([]string, 0)
+	for _, line := range actualLines {
+		if !slices.Contains(expectedLines, line) {
+			extra = append(extra, line)
+		}
+	}
+	missing := make([]string, 0)
+	for _, line := range expectedLines {
+		if !slices.Contains(actualLines, line) {
+			missing = append(missing, line)
+		}
+	}
+
+	return extra, missing
+}
+
+type offlineTarget struct {
+	schema  *schema.Schema
+	afterUp *schema.Schema
+}
+
+func (t *offlineTarget) apply(statements []string) (int, error) {
+	for i, statement := range statements {
+		if err := t.schema.Apply(statement); err != nil {
+			return i, err
+		}
+	}
+	return 0, nil
+}
+
+func (t *offlineTarget) snapshot() (map[string]string, error) {
+	snapshot := make(map[string]string)
+	for _, object := range t.schema.Objects() {
+		snapshot[object.Kind+" "+object.Name] = object.CQL
+	}
+	return snapshot, nil
+}
+
+func (t *offlineTarget) saveUp() {
+	t.afterUp = t.schema.Clone()
+}
+
+func (t *offlineTarget) restoreUp([]string) error {
+	t.schema = t.afterUp
+	return nil
+}
+
+type liveTarget struct {
+	ctx      context.Context
+	session  Session
+	keyspace string
+}
+
+func (t *liveTarget) apply(statements []string) (int, error) {
+	for i, statement := range statements {
+		if err := t.session.Exec(t.ctx, statement); err != nil {
+			return i, err
+		}
+	}
+	return 0, nil
+}
+
+func (t *liveTarget) saveUp() {}
+
+// restoreUp applies Up again. Elements that Down left behind already exist,
+// so "already exists" errors are ignored.
+func (t *liveTarget) restoreUp(statements []string) error {
+	for _, statement := range statements {
+		if err := t.session.Exec(t.ctx, statement); err != nil && !IsExistError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot reads the schema of the keyspace from system_schema.
+func (t *liveTarget) snapshot() (map[string]string, error) {
+	lines := make(map[string][]string)
+	views := make(map[string]bool)
+	query := func(statement string, scan func(iter Iter) bool) error {
+		iter := t.session.Iter(t.ctx, statement, t.keyspace)
+		for scan(iter) {
+		}
+		return iter.Close()
+	}
+
+	var name, baseTable, where string
+	err := query(`SELECT view_name, base_table_name, where_clause FROM system_schema.views WHERE keyspace_name = ?`, func(iter Iter) bool {
+		if !iter.Scan(&name, &baseTable, &where) {
+			return false
+		}
+		views[name] = true
+		key := "view " + t.keyspace + "." + name
+		lines[key] = append(lines[key], "from "+baseTable, "where "+where)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var column, kind, cqlType string
+	var position int
+	err = query(`SELECT table_name, column_name, kind, position, type FROM system_schema.columns WHERE keyspace_name = ?`, func(iter Iter) bool {
+		if !iter.Scan(&name, &column, &kind, &position, &cqlType) {
+			return false
+		}
+		key := "table " + t.keyspace + "." + name
+		if views[name] {
+			key = "view " + t.keyspace + "." + name
+		}
+		lines[key] = append(lines[key], fmt.Sprintf("%s %s %s %d", column, cqlType, kind, position))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var comment string
+	var ttl, gcGrace int
+	err = query(`SELECT table_name, comment, default_time_to_live, gc_grace_seconds FROM system_schema.tables WHERE keyspace_name = ?`, func(iter Iter) bool {
+		if !iter.Scan(&name, &comment, &ttl, &gcGrace) {
+			return false
+		}
+		key := "table " + t.keyspace + "." + name
+		lines[key] = append(lines[key], "comment = "+comment, fmt.Sprintf("default_time_to_live = %d", ttl), fmt.Sprintf("gc_grace_seconds = %d", gcGrace))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var options map[string]string
+	err = query(`SELECT table_name, index_name, kind, options FROM system_schema.indexes WHERE keyspace_name = ?`, func(iter Iter) bool {
+		var index string
+		if !iter.Scan(&name, &index, &kind, &options) {
+			return false
+		}
+		key := "index " + t.keyspace + "." + index
+		lines[key] = append(lines[key], "on "+name, "kind "+kind, "target "+options["target"], "class "+options["class_name"])
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var fieldNames, fieldTypes []string
+	err = query(`SELECT type_name, field_names, field_types FROM system_schema.types WHERE keyspace_name = ?`, func(iter Iter) bool {
+		if !iter.Scan(&name, &fieldNames, &fieldTypes) {
+			return false
+		}
+		key := "type " + t.keyspace + "." + name
+		for i := range fieldNames {
+			lines[key] = append(lines[key], fieldNames[i]+" "+fieldTypes[i])
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var argumentTypes []string
+	var returnType, body string
+	err = query(`SELECT function_name, argument_types, return_type, body FROM system_schema.functions WHERE keyspace_name = ?`, func(iter Iter) bool {
+		if !iter.Scan(&name, &argumentTypes, &returnType, &body) {
+			return false
+		}
+		key := "function " + t.keyspace + "." + name + "(" + strings.Join(argumentTypes, ", ") + ")"
+		lines[key] = append(lines[key], "returns "+returnType, "body "+body)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var stateFunction, stateType, finalFunction string
+	err = query(`SELECT aggregate_name, argument_types, state_func, state_type, final_func FROM system_schema.aggregates WHERE keyspace_name = ?`, func(iter Iter) bool {
+		if !iter.Scan(&name, &argumentTypes, &stateFunction, &stateType, &finalFunction) {
+			return false
+		}
+		key := "aggregate " + t.keyspace + "." + name + "(" + strings.Join(argumentTypes, ", ") + ")"
+		lines[key] = append(lines[key], "sfunc "+stateFunction, "stype "+stateType, "finalfunc "+finalFunction)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[string]string, len(lines))
+	for key, definition := range lines {
+		slices.Sort(definition)
+		snapshot[key] = strings.Join(definition, "\n")
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,68 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	writeMigrationFile(t, tempDir, "0001-create-users.cql", `-- +migrate Up
+CREATE TABLE users (
+  id uuid PRIMARY KEY,
+  email text
+);
+-- +migrate Down
+DROP TABLE users;
+`)
+	writeMigrationFile(t, tempDir, "0002-add-name.cql", `-- +migrate Up
+ALTER TABLE users ADD name text;
+CREATE INDEX users_by_name ON users (name);
+-- +migrate Down
+DROP INDEX users_by_name;
+`)
+	writeMigrationFile(t, tempDir, "0003-create-samples.cql", `-- +migrate Up
+CREATE TABLE samples (id uuid PRIMARY KEY);
+-- +migrate Down
+DROP TABLE sample;
+`)
+	writeMigrationFile(t, tempDir, "0004-create-orders.cql", `-- +migrate Up
+CREATE TABLE orders (id uuid PRIMARY KEY);
+-- +migrate Down
+`)
+	writeMigrationFile(t, tempDir, "R-users-by-email.cql", `-- +migrate Up
+CREATE MATERIALIZED VIEW IF NOT EXISTS users_by_email AS
+  SELECT * FROM users WHERE email IS NOT NULL AND id IS NOT NULL
+  PRIMARY KEY (email, id);
+`)
+
+	result, err := VerifyRoundTrip(Config{Keyspace: "bloodlab", MigrationDir: tempDir})
+	require.NoError(t, err)
+
+	require.Len(t, result.Migrations, 4)
+	assert.True(t, result.Migrations[0].OK())
+	assert.Equal(t, []string{"table bloodlab.users differs after Down, has name text"}, result.Migrations[1].Differences)
+	assert.EqualError(t, result.Migrations[2].Err, "0003-create-samples.cql:4: down: table bloodlab.sample not found")
+	assert.Equal(t, []string{"table bloodlab.orders is left behind by Down"}, result.Migrations[3].Differences)
+	assert.Len(t, result.Failed(), 3)
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	before := map[string]string{
+		"table ks.a": "CREATE TABLE ks.a (\n  id int PRIMARY KEY,\n  x text\n);",
+		"type ks.t":  "CREATE TYPE ks.t (f int);",
+	}
+	reverted := map[string]string{
+		"table ks.a": "CREATE TABLE ks.a (\n  id int PRIMARY KEY,\n  y text\n);",
+		"table ks.b": "CREATE TABLE ks.b (id int PRIMARY KEY);",
+	}
+
+	assert.Equal(t, []string{
+		"table ks.a differs after Down, has y text, lacks x text",
+		"table ks.b is left behind by Down",
+		"type ks.t is missing after Down",
+	}, diffSnapshots(before, reverted))
+	assert.Empty(t, diffSnapshots(before, before))
+}
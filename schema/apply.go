@@ -0,0 +1,1420 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Apply simulates statement on s. It returns an error for statements that
+// would fail on a cluster and leaves s unchanged in that case.
+func (s *Schema) Apply(statement string) error {
+	tokens, err := tokenize(statement)
+	if err != nil {
+		return fmt.Errorf("syntax error: %w", err)
+	}
+	p := &parser{tokens: tokens}
+	switch {
+	case p.acceptKeyword("CREATE"):
+		return s.create(p)
+	case p.acceptKeyword("ALTER"):
+		return s.alter(p)
+	case p.acceptKeyword("DROP"):
+		return s.drop(p)
+	case p.acceptKeyword("USE"):
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if _, err := s.keyspace(name); err != nil {
+			return err
+		}
+		s.Keyspace = name
+		return nil
+	case p.acceptKeyword("INSERT", "INTO"):
+		return s.insert(p)
+	case p.acceptKeyword("UPDATE"):
+		return s.update(p)
+	case p.acceptKeyword("DELETE"):
+		return s.deleteFrom(p)
+	case p.acceptKeyword("TRUNCATE"):
+		if !p.acceptKeyword("TABLE") {
+			p.acceptKeyword("COLUMNFAMILY")
+		}
+		return s.writableTable(p)
+	case p.acceptKeyword("SELECT"):
+		return s.selectFrom(p)
+	default:
+		return nil
+	}
+}
+
+// IsSchemaStatement reports whether statement is a USE or a CREATE, ALTER or
+// DROP of a schema element modelled by Schema. Data, role and permission
+// statements are not, so they are absent from Objects.
+func IsSchemaStatement(statement string) bool {
+	tokens, err := tokenize(statement)
+	if err != nil {
+		return false
+	}
+	p := &parser{tokens: tokens}
+	switch {
+	case p.acceptKeyword("USE"):
+		return true
+	case p.acceptKeyword("CREATE"):
+		p.acceptKeyword("OR", "REPLACE")
+		return p.isKeyword("KEYSPACE") || p.isKeyword("SCHEMA") || p.isKeyword("TABLE") || p.isKeyword("COLUMNFAMILY") ||
+			p.isKeyword("TYPE") || p.isKeyword("INDEX") || p.isKeyword("CUSTOM", "INDEX") || p.isKeyword("MATERIALIZED", "VIEW") ||
+			p.isKeyword("FUNCTION") || p.isKeyword("AGGREGATE")
+	case p.acceptKeyword("ALTER"):
+		return p.isKeyword("KEYSPACE") || p.isKeyword("SCHEMA") || p.isKeyword("TABLE") || p.isKeyword("COLUMNFAMILY") ||
+			p.isKeyword("TYPE") || p.isKeyword("MATERIALIZED", "VIEW")
+	case p.acceptKeyword("DROP"):
+		return p.isKeyword("KEYSPACE") || p.isKeyword("SCHEMA") || p.isKeyword("TABLE") || p.isKeyword("COLUMNFAMILY") ||
+			p.isKeyword("TYPE") || p.isKeyword("INDEX") || p.isKeyword("MATERIALIZED", "VIEW") ||
+			p.isKeyword("FUNCTION") || p.isKeyword("AGGREGATE")
+	default:
+		return false
+	}
+}
+
+func (s *Schema) create(p *parser) error {
+	orReplace := p.acceptKeyword("OR", "REPLACE")
+	switch {
+	case p.acceptKeyword("KEYSPACE"), p.acceptKeyword("SCHEMA"):
+		return s.createKeyspace(p)
+	case p.acceptKeyword("TABLE"), p.acceptKeyword("COLUMNFAMILY"):
+		return s.createTable(p)
+	case p.acceptKeyword("TYPE"):
+		return s.createType(p)
+	case p.acceptKeyword("INDEX"):
+		return s.createIndex(p, false)
+	case p.acceptKeyword("CUSTOM", "INDEX"):
+		return s.createIndex(p, true)
+	case p.acceptKeyword("MATERIALIZED", "VIEW"):
+		return s.createView(p)
+	case p.acceptKeyword("FUNCTION"):
+		return s.createFunction(p, orReplace)
+	case p.acceptKeyword("AGGREGATE"):
+		return s.createAggregate(p, orReplace)
+	default:
+		return nil
+	}
+}
+
+func (s *Schema) alter(p *parser) error {
+	switch {
+	case p.acceptKeyword("KEYSPACE"), p.acceptKeyword("SCHEMA"):
+		return s.alterKeyspace(p)
+	case p.acceptKeyword("TABLE"), p.acceptKeyword("COLUMNFAMILY"):
+		return s.alterTable(p)
+	case p.acceptKeyword("TYPE"):
+		return s.alterType(p)
+	case p.acceptKeyword("MATERIALIZED", "VIEW"):
+		return s.alterView(p)
+	default:
+		return nil
+	}
+}
+
+func (s *Schema) drop(p *parser) error {
+	switch {
+	case p.acceptKeyword("KEYSPACE"), p.acceptKeyword("SCHEMA"):
+		return s.dropKeyspace(p)
+	case p.acceptKeyword("TABLE"), p.acceptKeyword("COLUMNFAMILY"):
+		return s.dropTable(p)
+	case p.acceptKeyword("TYPE"):
+		return s.dropType(p)
+	case p.acceptKeyword("INDEX"):
+		return s.dropIndex(p)
+	case p.acceptKeyword("MATERIALIZED", "VIEW"):
+		return s.dropView(p)
+	case p.acceptKeyword("FUNCTION"):
+		return s.dropFunction(p, false)
+	case p.acceptKeyword("AGGREGATE"):
+		return s.dropFunction(p, true)
+	default:
+		return nil
+	}
+}
+
+// keyspace returns the named keyspace, or the current one for an empty name.
+func (s *Schema) keyspace(name string) (*Keyspace, error) {
+	if name == "" {
+		name = s.Keyspace
+	}
+	if name == "" {
+		return nil, errors.New("no keyspace specified and no current keyspace")
+	}
+	keyspace, ok := s.Keyspaces[name]
+	if !ok {
+		return nil, fmt.Errorf("keyspace %s not found", name)
+	}
+
+	return keyspace, nil
+}
+
+// table returns the named table, rejecting materialized views.
+func (s *Schema) table(keyspaceName, name string) (*Keyspace, *Table, error) {
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if table, ok := keyspace.Tables[name]; ok {
+		return keyspace, table, nil
+	}
+	if _, ok := keyspace.Views[name]; ok {
+		return nil, nil, fmt.Errorf("%s.%s is a materialized view, not a table", keyspace.Name, name)
+	}
+
+	return nil, nil, fmt.Errorf("table %s.%s not found", keyspace.Name, name)
+}
+
+func (s *Schema) createKeyspace(p *parser) error {
+	ifNotExists := p.acceptKeyword("IF", "NOT", "EXISTS")
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if err := p.expectKeyword("WITH"); err != nil {
+		return err
+	}
+	options, err := p.options()
+	if err != nil {
+		return err
+	}
+	if _, ok := options["replication"]; !ok {
+		return fmt.Errorf("keyspace %s requires a replication option", name)
+	}
+	if _, ok := s.Keyspaces[name]; ok {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("keyspace %s already exists", name)
+	}
+	s.Keyspaces[name] = newKeyspace(name, options)
+
+	return nil
+}
+
+func (s *Schema) alterKeyspace(p *parser) error {
+	ifExists := p.acceptKeyword("IF", "EXISTS")
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if err := p.expectKeyword("WITH"); err != nil {
+		return err
+	}
+	options, err := p.options()
+	if err != nil {
+		return err
+	}
+	keyspace, ok := s.Keyspaces[name]
+	if !ok {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("keyspace %s not found", name)
+	}
+	if keyspace.Options == nil {
+		keyspace.Options = make(map[string]string)
+	}
+	for option, value := range options {
+		keyspace.Options[option] = value
+	}
+
+	return nil
+}
+
+func (s *Schema) dropKeyspace(p *parser) error {
+	ifExists := p.acceptKeyword("IF", "EXISTS")
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+	if _, ok := s.Keyspaces[name]; !ok {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("keyspace %s not found", name)
+	}
+	delete(s.Keyspaces, name)
+	if s.Keyspace == name {
+		s.Keyspace = ""
+	}
+
+	return nil
+}
+
+func (s *Schema) createTable(p *parser) error {
+	ifNotExists := p.acceptKeyword("IF", "NOT", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	table := &Table{Name: name}
+	if err := p.expectSymbol("("); err != nil {
+		return err
+	}
+	hasPrimaryKey := false
+	for {
+		if p.acceptKeyword("PRIMARY", "KEY") {
+			if hasPrimaryKey {
+				return fmt.Errorf("table %s.%s has multiple primary keys", keyspace.Name, name)
+			}
+			hasPrimaryKey = true
+			if table.PartitionKey, table.ClusteringKey, err = p.primaryKey(); err != nil {
+				return err
+			}
+		} else {
+			column, err := p.column(keyspace.Name)
+			if err != nil {
+				return err
+			}
+			if table.Column(column.Name) != nil {
+				return fmt.Errorf("duplicate column %s in table %s.%s", column.Name, keyspace.Name, name)
+			}
+			table.Columns = append(table.Columns, column)
+			if p.acceptKeyword("PRIMARY", "KEY") {
+				if hasPrimaryKey {
+					return fmt.Errorf("table %s.%s has multiple primary keys", keyspace.Name, name)
+				}
+				hasPrimaryKey = true
+				table.PartitionKey = []string{column.Name}
+			}
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return err
+	}
+	if p.acceptKeyword("WITH") {
+		if table.Options, err = p.options(); err != nil {
+			return err
+		}
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+
+	if !hasPrimaryKey {
+		return fmt.Errorf("table %s.%s has no primary key", keyspace.Name, name)
+	}
+	keyColumns := append(slices.Clone(table.PartitionKey), table.ClusteringKey...)
+	for i, column := range keyColumns {
+		if table.Column(column) == nil {
+			return fmt.Errorf("unknown column %s in primary key of table %s.%s", column, keyspace.Name, name)
+		}
+		if slices.Contains(keyColumns[:i], column) {
+			return fmt.Errorf("column %s appears twice in primary key of table %s.%s", column, keyspace.Name, name)
+		}
+	}
+	for _, column := range table.Columns {
+		if err := checkStatic(keyspace, table, column); err != nil {
+			return err
+		}
+		if err := checkTypes(keyspace, column.Type); err != nil {
+			return err
+		}
+	}
+	if _, ok := keyspace.Tables[name]; ok || keyspace.Views[name] != nil {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("table %s.%s already exists", keyspace.Name, name)
+	}
+	keyspace.Tables[name] = table
+
+	return nil
+}
+
+// column reads "name type [STATIC]".
+func (p *parser) column(keyspace string) (Column, error) {
+	name, err := p.name()
+	if err != nil {
+		return Column{}, err
+	}
+	cqlType, err := p.cqlType(keyspace)
+	if err != nil {
+		return Column{}, err
+	}
+
+	return Column{Name: name, Type: cqlType, Static: p.acceptKeyword("STATIC")}, nil
+}
+
+// primaryKey reads "(partition, clustering...)" or "((partition...), clustering...)".
+func (p *parser) primaryKey() ([]string, []string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, nil, err
+	}
+	var partitionKey []string
+	if p.isSymbol("(") {
+		names, err := p.nameList()
+		if err != nil {
+			return nil, nil, err
+		}
+		partitionKey = names
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, nil, err
+		}
+		partitionKey = []string{name}
+	}
+	clusteringKey := make([]string, 0)
+	for p.acceptSymbol(",") {
+		name, err := p.name()
+		if err != nil {
+			return nil, nil, err
+		}
+		clusteringKey = append(clusteringKey, name)
+	}
+
+	return partitionKey, clusteringKey, p.expectSymbol(")")
+}
+
+func checkStatic(keyspace *Keyspace, table *Table, column Column) error {
+	if !column.Static {
+		return nil
+	}
+	if table.IsPrimaryKey(column.Name) {
+		return fmt.Errorf("primary key column %s of table %s.%s cannot be static", column.Name, keyspace.Name, table.Name)
+	}
+	if len(table.ClusteringKey) == 0 {
+		return fmt.Errorf("static column %s requires clustering columns in table %s.%s", column.Name, keyspace.Name, table.Name)
+	}
+
+	return nil
+}
+
+// checkTypes reports user defined types used by cqlType that do not exist.
+func checkTypes(keyspace *Keyspace, cqlType string) error {
+	for _, name := range typeReferences(cqlType) {
+		if _, ok := keyspace.Types[name]; !ok {
+			return fmt.Errorf("type %s not found in keyspace %s", name, keyspace.Name)
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) alterTable(p *parser) error {
+	ifExists := p.acceptKeyword("IF", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	keyspace, table, err := s.table(keyspaceName, name)
+	if err != nil {
+		if ifExists && strings.HasSuffix(err.Error(), "not found") {
+			return nil
+		}
+		return err
+	}
+	switch {
+	case p.acceptKeyword("ADD"):
+		return alterTableAdd(p, keyspace, table)
+	case p.acceptKeyword("DROP"):
+		return alterTableDrop(p, keyspace, table)
+	case p.acceptKeyword("RENAME"):
+		return alterTableRename(p, keyspace, table)
+	case p.acceptKeyword("ALTER"):
+		column, err := p.name()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("altering the type of column %s of table %s.%s is not supported", column, keyspace.Name, name)
+	case p.acceptKeyword("WITH"):
+		options, err := p.options()
+		if err != nil {
+			return err
+		}
+		if _, ok := options[clusteringOrderOption]; ok {
+			return fmt.Errorf("clustering order of table %s.%s cannot be altered", keyspace.Name, name)
+		}
+		if table.Options == nil {
+			table.Options = make(map[string]string)
+		}
+		for option, value := range options {
+			table.Options[option] = value
+		}
+		return nil
+	default:
+		return p.unexpected("ADD, DROP, RENAME, ALTER or WITH")
+	}
+}
+
+func alterTableAdd(p *parser, keyspace *Keyspace, table *Table) error {
+	ifNotExists := p.acceptKeyword("IF", "NOT", "EXISTS")
+	parenthesized := p.acceptSymbol("(")
+	columns := make([]Column, 0, 1)
+	for {
+		column, err := p.column(keyspace.Name)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, column)
+		if !parenthesized || !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if parenthesized {
+		if err := p.expectSymbol(")"); err != nil {
+			return err
+		}
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+	added := make([]Column, 0, len(columns))
+	for _, column := range columns {
+		if table.Column(column.Name) != nil || slices.ContainsFunc(added, func(c Column) bool { return c.Name == column.Name }) {
+			if ifNotExists {
+				continue
+			}
+			return fmt.Errorf("column %s already exists in table %s.%s", column.Name, keyspace.Name, table.Name)
+		}
+		if err := checkStatic(keyspace, table, column); err != nil {
+			return err
+		}
+		if err := checkTypes(keyspace, column.Type); err != nil {
+			return err
+		}
+		added = append(added, column)
+	}
+	table.Columns = append(table.Columns, added...)
+
+	return nil
+}
+
+func alterTableDrop(p *parser, keyspace *Keyspace, table *Table) error {
+	ifExists := p.acceptKeyword("IF", "EXISTS")
+	var columns []string
+	if p.isSymbol("(") {
+		names, err := p.nameList()
+		if err != nil {
+			return err
+		}
+		columns = names
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		columns = []string{name}
+	}
+	if p.acceptKeyword("USING", "TIMESTAMP") {
+		p.pos++
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+	dropped := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if table.Column(column) == nil {
+			if ifExists {
+				continue
+			}
+			return fmt.Errorf("column %s not found in table %s.%s", column, keyspace.Name, table.Name)
+		}
+		if table.IsPrimaryKey(column) {
+			return fmt.Errorf("cannot drop primary key column %s of table %s.%s", column, keyspace.Name, table.Name)
+		}
+		if views := dependentViews(keyspace, table.Name); len(views) > 0 {
+			return fmt.Errorf("cannot drop column %s of table %s.%s with materialized views: %s", column, keyspace.Name, table.Name, strings.Join(views, ", "))
+		}
+		if indexes := dependentIndexes(keyspace, table.Name, column); len(indexes) > 0 {
+			return fmt.Errorf("cannot drop column %s of table %s.%s, it has secondary indexes: %s", column, keyspace.Name, table.Name, strings.Join(indexes, ", "))
+		}
+		dropped = append(dropped, column)
+	}
+	table.Columns = slices.DeleteFunc(table.Columns, func(column Column) bool {
+		return slices.Contains(dropped, column.Name)
+	})
+
+	return nil
+}
+
+func alterTableRename(p *parser, keyspace *Keyspace, table *Table) error {
+	p.acceptKeyword("IF", "EXISTS")
+	renames := make([][2]string, 0, 1)
+	for {
+		from, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err := p.expectKeyword("TO"); err != nil {
+			return err
+		}
+		to, err := p.name()
+		if err != nil {
+			return err
+		}
+		renames = append(renames, [2]string{from, to})
+		if !p.acceptKeyword("AND") {
+			break
+		}
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+	renamed := &Table{
+		Name:          table.Name,
+		Columns:       slices.Clone(table.Columns),
+		PartitionKey:  slices.Clone(table.PartitionKey),
+		ClusteringKey: slices.Clone(table.ClusteringKey),
+	}
+	for _, rename := range renames {
+		from, to := rename[0], rename[1]
+		column := renamed.Column(from)
+		if column == nil {
+			return fmt.Errorf("column %s not found in table %s.%s", from, keyspace.Name, table.Name)
+		}
+		if !renamed.IsPrimaryKey(from) {
+			return fmt.Errorf("cannot rename non primary key column %s of table %s.%s", from, keyspace.Name, table.Name)
+		}
+		if renamed.Column(to) != nil {
+			return fmt.Errorf("column %s already exists in table %s.%s", to, keyspace.Name, table.Name)
+		}
+		if indexes := dependentIndexes(keyspace, table.Name, from); len(indexes) > 0 {
+			return fmt.Errorf("cannot rename column %s of table %s.%s, it has secondary indexes: %s", from, keyspace.Name, table.Name, strings.Join(indexes, ", "))
+		}
+		column.Name = to
+		for _, key := range [][]string{renamed.PartitionKey, renamed.ClusteringKey} {
+			if i := slices.Index(key, from); i >= 0 {
+				key[i] = to
+			}
+		}
+	}
+	table.Columns, table.PartitionKey, table.ClusteringKey = renamed.Columns, renamed.PartitionKey, renamed.ClusteringKey
+
+	return nil
+}
+
+func dependentViews(keyspace *Keyspace, table string) []string {
+	views := make([]string, 0)
+	for _, name := range sortedKeys(keyspace.Views) {
+		if keyspace.Views[name].BaseTable == table {
+			views = append(views, name)
+		}
+	}
+
+	return views
+}
+
+func dependentIndexes(keyspace *Keyspace, table, column string) []string {
+	indexes := make([]string, 0)
+	for _, name := range sortedKeys(keyspace.Indexes) {
+		index := keyspace.Indexes[name]
+		if index.Table == table && indexColumn(index.Target) == column {
+			indexes = append(indexes, name)
+		}
+	}
+
+	return indexes
+}
+
+// indexColumn returns the column of an index target such as keys(tags).
+func indexColumn(target string) string {
+	if open := strings.Index(target, "("); open >= 0 && strings.HasSuffix(target, ")") {
+		target = target[open+1 : len(target)-1]
+	}
+
+	return normalizeName(target)
+}
+
+func (s *Schema) dropTable(p *parser) error {
+	ifExists := p.acceptKeyword("IF", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+	keyspace, _, err := s.table(keyspaceName, name)
+	if err != nil {
+		if ifExists && strings.HasSuffix(err.Error(), "not found") {
+			return nil
+		}
+		return err
+	}
+	if views := dependentViews(keyspace, name); len(views) > 0 {
+		return fmt.Errorf("cannot drop table %s.%s with materialized views: %s", keyspace.Name, name, strings.Join(views, ", "))
+	}
+	delete(keyspace.Tables, name)
+	for indexName, index := range keyspace.Indexes {
+		if index.Table == name {
+			delete(keyspace.Indexes, indexName)
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) createType(p *parser) error {
+	ifNotExists := p.acceptKeyword("IF", "NOT", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return err
+	}
+	udt := &Type{Name: name}
+	for {
+		field, err := p.column(keyspace.Name)
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(udt.Fields, func(f Column) bool { return f.Name == field.Name }) {
+			return fmt.Errorf("duplicate field %s in type %s.%s", field.Name, keyspace.Name, name)
+		}
+		udt.Fields = append(udt.Fields, field)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return err
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+	for _, field := range udt.Fields {
+		if slices.Contains(typeReferences(field.Type), name) {
+			return fmt.Errorf("type %s.%s cannot refer to itself", keyspace.Name, name)
+		}
+		if err := checkTypes(keyspace, field.Type); err != nil {
+			return err
+		}
+	}
+	if _, ok := keyspace.Types[name]; ok {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("type %s.%s already exists", keyspace.Name, name)
+	}
+	keyspace.Types[name] = udt
+
+	return nil
+}
+
+func (s *Schema) alterType(p *parser) error {
+	ifExists := p.acceptKeyword("IF", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	udt, ok := keyspace.Types[name]
+	if !ok {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("type %s.%s not found", keyspace.Name, name)
+	}
+	hasField := func(fields []Column, name string) int {
+		return slices.IndexFunc(fields, func(f Column) bool { return f.Name == name })
+	}
+	switch {
+	case p.acceptKeyword("ADD"):
+		ifNotExists := p.acceptKeyword("IF", "NOT", "EXISTS")
+		field, err := p.column(keyspace.Name)
+		if err != nil {
+			return err
+		}
+		if err := p.expectDone(); err != nil {
+			return err
+		}
+		if hasField(udt.Fields, field.Name) >= 0 {
+			if ifNotExists {
+				return nil
+			}
+			return fmt.Errorf("field %s already exists in type %s.%s", field.Name, keyspace.Name, name)
+		}
+		if err := checkTypes(keyspace, field.Type); err != nil {
+			return err
+		}
+		udt.Fields = append(udt.Fields, field)
+	case p.acceptKeyword("RENAME"):
+		p.acceptKeyword("IF", "EXISTS")
+		fields := slices.Clone(udt.Fields)
+		for {
+			from, err := p.name()
+			if err != nil {
+				return err
+			}
+			if err := p.expectKeyword("TO"); err != nil {
+				return err
+			}
+			to, err := p.name()
+			if err != nil {
+				return err
+			}
+			index := hasField(fields, from)
+			if index < 0 {
+				return fmt.Errorf("field %s not found in type %s.%s", from, keyspace.Name, name)
+			}
+			if hasField(fields, to) >= 0 {
+				return fmt.Errorf("field %s already exists in type %s.%s", to, keyspace.Name, name)
+			}
+			fields[index].Name = to
+			if !p.acceptKeyword("AND") {
+				break
+			}
+		}
+		if err := p.expectDone(); err != nil {
+			return err
+		}
+		udt.Fields = fields
+	case p.acceptKeyword("ALTER"):
+		field, err := p.name()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("altering the type of field %s of type %s.%s is not supported", field, keyspace.Name, name)
+	default:
+		return p.unexpected("ADD, RENAME or ALTER")
+	}
+
+	return nil
+}
+
+func (s *Schema) dropType(p *parser) error {
+	ifExists := p.acceptKeyword("IF", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	if _, ok := keyspace.Types[name]; !ok {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("type %s.%s not found", keyspace.Name, name)
+	}
+	users := make([]string, 0)
+	for _, tableName := range sortedKeys(keyspace.Tables) {
+		for _, column := range keyspace.Tables[tableName].Columns {
+			if slices.Contains(typeReferences(column.Type), name) {
+				users = append(users, "table "+tableName)
+				break
+			}
+		}
+	}
+	for _, typeName := range sortedKeys(keyspace.Types) {
+		for _, field := range keyspace.Types[typeName].Fields {
+			if slices.Contains(typeReferences(field.Type), name) {
+				users = append(users, "type "+typeName)
+				break
+			}
+		}
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("cannot drop type %s.%s, it is used by %s", keyspace.Name, name, strings.Join(users, ", "))
+	}
+	delete(keyspace.Types, name)
+
+	return nil
+}
+
+func (s *Schema) createIndex(p *parser, custom bool) error {
+	ifNotExists := p.acceptKeyword("IF", "NOT", "EXISTS")
+	name := ""
+	if !p.isKeyword("ON") {
+		var err error
+		if name, err = p.name(); err != nil {
+			return err
+		}
+	}
+	if err := p.expectKeyword("ON"); err != nil {
+		return err
+	}
+	keyspaceName, tableName, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return err
+	}
+	kind := ""
+	for _, k := range []string{"KEYS", "VALUES", "ENTRIES", "FULL"} {
+		if p.isKeyword(k) && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "(" {
+			kind = strings.ToLower(k)
+			p.pos += 2
+			break
+		}
+	}
+	column, err := p.name()
+	if err != nil {
+		return err
+	}
+	if kind != "" {
+		if err := p.expectSymbol(")"); err != nil {
+			return err
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return err
+	}
+	using := ""
+	if p.acceptKeyword("USING") {
+		t, ok := p.peek()
+		if !ok || t.kind != tokenString {
+			return p.unexpected("index class")
+		}
+		using = t.text
+		p.pos++
+		if p.acceptKeyword("WITH") {
+			if _, err := p.options(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+	if custom && using == "" {
+		return errors.New("custom index requires USING")
+	}
+
+	keyspace, table, err := s.table(keyspaceName, tableName)
+	if err != nil {
+		if strings.Contains(err.Error(), "materialized view") {
+			return fmt.Errorf("secondary indexes are not supported on materialized view %s", tableName)
+		}
+		return err
+	}
+	if table.Column(column) == nil {
+		return fmt.Errorf("column %s not found in table %s.%s", column, keyspace.Name, tableName)
+	}
+	if name == "" {
+		name = tableName + "_" + column + "_idx"
+	}
+	target := quoteName(column)
+	if kind != "" {
+		target = kind + "(" + target + ")"
+	}
+	if _, ok := keyspace.Indexes[name]; ok {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("index %s already exists in keyspace %s", name, keyspace.Name)
+	}
+	keyspace.Indexes[name] = &Index{Name: name, Table: tableName, Target: target, Using: using}
+
+	return nil
+}
+
+func (s *Schema) dropIndex(p *parser) error {
+	ifExists := p.acceptKeyword("IF", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	if _, ok := keyspace.Indexes[name]; !ok {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("index %s not found in keyspace %s", name, keyspace.Name)
+	}
+	delete(keyspace.Indexes, name)
+
+	return nil
+}
+
+func (s *Schema) createView(p *parser) error {
+	ifNotExists := p.acceptKeyword("IF", "NOT", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if err := p.expectKeyword("AS", "SELECT"); err != nil {
+		return err
+	}
+	var selected []string
+	if !p.acceptSymbol("*") {
+		for {
+			column, err := p.name()
+			if err != nil {
+				return err
+			}
+			selected = append(selected, column)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return err
+	}
+	baseKeyspace, baseName, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	view := &View{Name: name, BaseTable: baseName}
+	if p.acceptKeyword("WHERE") {
+		start := p.pos
+		for !p.done() && !p.isKeyword("PRIMARY", "KEY") {
+			if err := p.skipValue(); err != nil {
+				return err
+			}
+		}
+		view.Where = render(p.tokens[start:p.pos], false)
+	}
+	if err := p.expectKeyword("PRIMARY", "KEY"); err != nil {
+		return err
+	}
+	if view.PartitionKey, view.ClusteringKey, err = p.primaryKey(); err != nil {
+		return err
+	}
+	if p.acceptKeyword("WITH") {
+		if view.Options, err = p.options(); err != nil {
+			return err
+		}
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	if baseKeyspace != "" && baseKeyspace != keyspace.Name {
+		return fmt.Errorf("materialized view %s.%s must be in the keyspace of its base table", keyspace.Name, name)
+	}
+	_, base, err := s.table(keyspace.Name, baseName)
+	if err != nil {
+		return err
+	}
+	if selected == nil {
+		for _, column := range base.Columns {
+			selected = append(selected, column.Name)
+		}
+	}
+	for _, column := range selected {
+		if base.Column(column) == nil {
+			return fmt.Errorf("column %s not found in table %s.%s", column, keyspace.Name, baseName)
+		}
+	}
+	viewKey := append(slices.Clone(view.PartitionKey), view.ClusteringKey...)
+	nonKey := make([]string, 0)
+	for _, column := range viewKey {
+		if base.Column(column) == nil {
+			return fmt.Errorf("column %s not found in table %s.%s", column, keyspace.Name, baseName)
+		}
+		if !base.IsPrimaryKey(column) {
+			nonKey = append(nonKey, column)
+		}
+		if !slices.Contains(selected, column) {
+			selected = append(selected, column)
+		}
+	}
+	if len(nonKey) > 1 {
+		return fmt.Errorf("materialized view %s.%s can include at most one non primary key column of %s in its primary key, got %s", keyspace.Name, name, baseName, strings.Join(nonKey, ", "))
+	}
+	missing := make([]string, 0)
+	for _, column := range append(slices.Clone(base.PartitionKey), base.ClusteringKey...) {
+		if !slices.Contains(viewKey, column) {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("primary key of materialized view %s.%s must include all primary key columns of %s, missing: %s", keyspace.Name, name, baseName, strings.Join(missing, ", "))
+	}
+	view.Columns = selected
+	if _, ok := keyspace.Views[name]; ok || keyspace.Tables[name] != nil {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("materialized view %s.%s already exists", keyspace.Name, name)
+	}
+	keyspace.Views[name] = view
+
+	return nil
+}
+
+func (s *Schema) alterView(p *parser) error {
+	ifExists := p.acceptKeyword("IF", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if err := p.expectKeyword("WITH"); err != nil {
+		return err
+	}
+	options, err := p.options()
+	if err != nil {
+		return err
+	}
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	view, ok := keyspace.Views[name]
+	if !ok {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("materialized view %s.%s not found", keyspace.Name, name)
+	}
+	if view.Options == nil {
+		view.Options = make(map[string]string)
+	}
+	for option, value := range options {
+		view.Options[option] = value
+	}
+
+	return nil
+}
+
+func (s *Schema) dropView(p *parser) error {
+	ifExists := p.acceptKeyword("IF", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	if _, ok := keyspace.Views[name]; !ok {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("materialized view %s.%s not found", keyspace.Name, name)
+	}
+	delete(keyspace.Views, name)
+
+	return nil
+}
+
+func (s *Schema) createFunction(p *parser, orReplace bool) error {
+	ifNotExists := p.acceptKeyword("IF", "NOT", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return err
+	}
+	function := &Function{Name: name, Arguments: make([]string, 0)}
+	types := make([]string, 0)
+	for !p.isSymbol(")") {
+		argument, err := p.name()
+		if err != nil {
+			return err
+		}
+		cqlType, err := p.cqlType(keyspace.Name)
+		if err != nil {
+			return err
+		}
+		function.Arguments = append(function.Arguments, quoteName(argument)+" "+cqlType)
+		types = append(types, cqlType)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return err
+	}
+	function.Definition = p.rest()
+	if function.Definition == "" {
+		return p.unexpected("function definition")
+	}
+
+	return addFunction(keyspace, keyspace.Functions, function, types, "function", orReplace, ifNotExists)
+}
+
+func (s *Schema) createAggregate(p *parser, orReplace bool) error {
+	ifNotExists := p.acceptKeyword("IF", "NOT", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return err
+	}
+	aggregate := &Function{Name: name, Arguments: make([]string, 0)}
+	for !p.isSymbol(")") {
+		cqlType, err := p.cqlType(keyspace.Name)
+		if err != nil {
+			return err
+		}
+		aggregate.Arguments = append(aggregate.Arguments, cqlType)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return err
+	}
+	start := p.pos
+	for !p.done() {
+		if p.acceptKeyword("SFUNC") || p.acceptKeyword("FINALFUNC") {
+			function, err := p.name()
+			if err != nil {
+				return err
+			}
+			if !hasFunction(keyspace.Functions, function) {
+				return fmt.Errorf("function %s not found in keyspace %s", function, keyspace.Name)
+			}
+			continue
+		}
+		p.pos++
+	}
+	p.pos = start
+	aggregate.Definition = p.rest()
+	if !strings.Contains(strings.ToUpper(aggregate.Definition), "SFUNC") {
+		return fmt.Errorf("aggregate %s.%s requires SFUNC", keyspace.Name, name)
+	}
+
+	return addFunction(keyspace, keyspace.Aggregates, aggregate, aggregate.Arguments, "aggregate", orReplace, ifNotExists)
+}
+
+func addFunction(keyspace *Keyspace, functions map[string]*Function, function *Function, types []string, kind string, orReplace, ifNotExists bool) error {
+	signature := function.Name + "(" + strings.Join(types, ", ") + ")"
+	if _, ok := functions[signature]; ok && !orReplace {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("%s %s.%s already exists", kind, keyspace.Name, signature)
+	}
+	functions[signature] = function
+
+	return nil
+}
+
+func hasFunction(functions map[string]*Function, name string) bool {
+	for _, function := range functions {
+		if function.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Schema) dropFunction(p *parser, aggregate bool) error {
+	ifExists := p.acceptKeyword("IF", "EXISTS")
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	functions, kind := keyspace.Functions, "function"
+	if aggregate {
+		functions, kind = keyspace.Aggregates, "aggregate"
+	}
+	var signatures []string
+	if p.acceptSymbol("(") {
+		types := make([]string, 0)
+		for !p.isSymbol(")") {
+			cqlType, err := p.cqlType(keyspace.Name)
+			if err != nil {
+				return err
+			}
+			types = append(types, cqlType)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return err
+		}
+		signature := name + "(" + strings.Join(types, ", ") + ")"
+		if _, ok := functions[signature]; ok {
+			signatures = append(signatures, signature)
+		}
+	} else {
+		for signature, function := range functions {
+			if function.Name == name {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+	if err := p.expectDone(); err != nil {
+		return err
+	}
+	switch {
+	case len(signatures) == 0 && ifExists:
+		return nil
+	case len(signatures) == 0:
+		return fmt.Errorf("%s %s.%s not found", kind, keyspace.Name, name)
+	case len(signatures) > 1:
+		return fmt.Errorf("%s %s.%s is overloaded, specify the argument types", kind, keyspace.Name, name)
+	}
+	delete(functions, signatures[0])
+
+	return nil
+}
+
+// writableTable checks that the table named next exists and is not a view.
+func (s *Schema) writableTable(p *parser) error {
+	_, err := s.targetTable(p)
+	return err
+}
+
+func (s *Schema) targetTable(p *parser) (*Table, error) {
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	_, table, err := s.table(keyspaceName, name)
+	if err != nil && strings.Contains(err.Error(), "materialized view") {
+		return nil, fmt.Errorf("cannot write to materialized view %s", name)
+	}
+
+	return table, err
+}
+
+func (s *Schema) insert(p *parser) error {
+	table, err := s.targetTable(p)
+	if err != nil {
+		return err
+	}
+	if !p.isSymbol("(") {
+		return nil
+	}
+	columns, err := p.nameList()
+	if err != nil {
+		return err
+	}
+
+	return checkColumns(table, columns)
+}
+
+func (s *Schema) update(p *parser) error {
+	table, err := s.targetTable(p)
+	if err != nil {
+		return err
+	}
+	for !p.done() && !p.isKeyword("SET") {
+		p.pos++
+	}
+	if err := p.expectKeyword("SET"); err != nil {
+		return err
+	}
+	columns := make([]string, 0)
+	for {
+		column, err := p.name()
+		if err != nil {
+			return err
+		}
+		columns = append(columns, column)
+		for !p.done() && !p.isSymbol(",") && !p.isKeyword("WHERE") {
+			if err := p.skipValue(); err != nil {
+				return err
+			}
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	return checkColumns(table, columns)
+}
+
+func (s *Schema) deleteFrom(p *parser) error {
+	columns := make([]string, 0)
+	for !p.done() && !p.isKeyword("FROM") {
+		if t, _ := p.peek(); t.kind == tokenIdentifier || t.kind == tokenQuotedIdentifier {
+			column, _ := p.name()
+			columns = append(columns, column)
+			continue
+		}
+		if err := p.skipValue(); err != nil {
+			return err
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return err
+	}
+	table, err := s.targetTable(p)
+	if err != nil {
+		return err
+	}
+
+	return checkColumns(table, columns)
+}
+
+func (s *Schema) selectFrom(p *parser) error {
+	for !p.done() && !p.isKeyword("FROM") {
+		if err := p.skipValue(); err != nil {
+			return err
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return err
+	}
+	keyspaceName, name, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	keyspace, err := s.keyspace(keyspaceName)
+	if err != nil {
+		return err
+	}
+	if keyspace.Tables[name] == nil && keyspace.Views[name] == nil {
+		return fmt.Errorf("table %s.%s not found", keyspace.Name, name)
+	}
+
+	return nil
+}
+
+func checkColumns(table *Table, columns []string) error {
+	for _, column := range columns {
+		if table.Column(column) == nil {
+			return fmt.Errorf("column %s not found in table %s", column, table.Name)
+		}
+	}
+
+	return nil
+}
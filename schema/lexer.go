@@ -0,0 +1,117 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenIdentifier tokenKind = iota
+	tokenQuotedIdentifier
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// keyword reports whether t is the unquoted keyword kw, compared case insensitively.
+func (t token) keyword(kw string) bool {
+	return t.kind == tokenIdentifier && strings.EqualFold(t.text, kw)
+}
+
+// tokenize splits a CQL statement into tokens, dropping comments and whitespace.
+func tokenize(statement string) ([]token, error) {
+	runes := []rune(statement)
+	tokens := make([]token, 0)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-', r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := indexRunes(runes, i+2, "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i = end + 2
+		case r == '\'' || r == '"':
+			text, next, err := quoted(runes, i, r)
+			if err != nil {
+				return nil, err
+			}
+			kind := tokenString
+			if r == '"' {
+				kind = tokenQuotedIdentifier
+			}
+			tokens = append(tokens, token{kind: kind, text: text})
+			i = next
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '$':
+			end := indexRunes(runes, i+2, "$$")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated $$ string")
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[i+2 : end])})
+			i = end + 2
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, text: string(runes[start:i])})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || unicode.IsLetter(runes[i]) || runes[i] == '.' || runes[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i])})
+		default:
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(r)})
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+// quoted reads a string or quoted identifier starting at runes[start], where
+// a doubled quote stands for the quote itself.
+func quoted(runes []rune, start int, quote rune) (string, int, error) {
+	var text strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] != quote {
+			text.WriteRune(runes[i])
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == quote {
+			text.WriteRune(quote)
+			i++
+			continue
+		}
+		return text.String(), i + 1, nil
+	}
+
+	return "", 0, fmt.Errorf("unterminated %c quote", quote)
+}
+
+// indexRunes returns the index of the first occurrence of sub in runes at or
+// after from, or -1.
+func indexRunes(runes []rune, from int, sub string) int {
+	index := strings.Index(string(runes[from:]), sub)
+	if index < 0 {
+		return -1
+	}
+
+	return from + len([]rune(string(runes[from:])[:index]))
+}
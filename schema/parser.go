@@ -0,0 +1,338 @@
+package schema
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	clusteringOrderOption = "clustering order by"
+	compactStorageOption  = "compact storage"
+)
+
+var nativeTypes = map[string]bool{
+	"ascii": true, "bigint": true, "blob": true, "boolean": true, "counter": true, "date": true,
+	"decimal": true, "double": true, "duration": true, "float": true, "inet": true, "int": true,
+	"smallint": true, "text": true, "time": true, "timestamp": true, "timeuuid": true,
+	"tinyint": true, "uuid": true, "varchar": true, "varint": true,
+}
+
+var parameterizedTypes = map[string]bool{
+	"list": true, "set": true, "map": true, "frozen": true, "tuple": true, "vector": true,
+}
+
+// parser reads the tokens of one statement.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// done reports whether only an optional semicolon is left.
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens) || p.pos == len(p.tokens)-1 && p.tokens[p.pos].text == ";" && p.tokens[p.pos].kind == tokenSymbol
+}
+
+// isKeyword reports whether the next tokens are the keywords kws.
+func (p *parser) isKeyword(kws ...string) bool {
+	for i, kw := range kws {
+		if p.pos+i >= len(p.tokens) || !p.tokens[p.pos+i].keyword(kw) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *parser) acceptKeyword(kws ...string) bool {
+	if !p.isKeyword(kws...) {
+		return false
+	}
+	p.pos += len(kws)
+	return true
+}
+
+func (p *parser) expectKeyword(kws ...string) error {
+	if !p.acceptKeyword(kws...) {
+		return p.unexpected(strings.Join(kws, " "))
+	}
+	return nil
+}
+
+func (p *parser) isSymbol(symbol string) bool {
+	t, ok := p.peek()
+	return ok && t.kind == tokenSymbol && t.text == symbol
+}
+
+func (p *parser) acceptSymbol(symbol string) bool {
+	if !p.isSymbol(symbol) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.unexpected(symbol)
+	}
+	return nil
+}
+
+func (p *parser) unexpected(expected string) error {
+	t, ok := p.peek()
+	if !ok {
+		return fmt.Errorf("syntax error: expected %s at end of statement", expected)
+	}
+	return fmt.Errorf("syntax error: expected %s near %q", expected, t.text)
+}
+
+func (p *parser) expectDone() error {
+	if !p.done() {
+		return p.unexpected("end of statement")
+	}
+	return nil
+}
+
+// name reads an identifier, lower casing it unless it is quoted.
+func (p *parser) name() (string, error) {
+	t, ok := p.peek()
+	if !ok || t.kind != tokenIdentifier && t.kind != tokenQuotedIdentifier {
+		return "", p.unexpected("name")
+	}
+	p.pos++
+	if t.kind == tokenQuotedIdentifier {
+		return t.text, nil
+	}
+	return strings.ToLower(t.text), nil
+}
+
+// qualifiedName reads [keyspace.]name. The keyspace is empty when omitted.
+func (p *parser) qualifiedName() (string, string, error) {
+	name, err := p.name()
+	if err != nil {
+		return "", "", err
+	}
+	if !p.acceptSymbol(".") {
+		return "", name, nil
+	}
+	qualified, err := p.name()
+	if err != nil {
+		return "", "", err
+	}
+	return name, qualified, nil
+}
+
+// nameList reads "(name, ...)".
+func (p *parser) nameList() ([]string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	return names, p.expectSymbol(")")
+}
+
+// cqlType reads a type and returns it in canonical form, with user defined
+// types unqualified. Types of another keyspace than keyspace are rejected,
+// like Cassandra does.
+func (p *parser) cqlType(keyspace string) (string, error) {
+	t, ok := p.peek()
+	if ok && t.kind == tokenString {
+		p.pos++
+		return "'" + strings.ReplaceAll(t.text, "'", "''") + "'", nil
+	}
+	typeKeyspace, name, err := p.qualifiedName()
+	if err != nil {
+		return "", err
+	}
+	if typeKeyspace != "" && typeKeyspace != keyspace {
+		return "", fmt.Errorf("type %s.%s must be in keyspace %s", typeKeyspace, name, keyspace)
+	}
+	if name == "varchar" {
+		name = "text"
+	}
+	if !parameterizedTypes[name] {
+		return quoteName(name), nil
+	}
+	if err := p.expectSymbol("<"); err != nil {
+		return "", err
+	}
+	parameters := make([]string, 0, 2)
+	for {
+		if t, ok := p.peek(); ok && t.kind == tokenNumber {
+			p.pos++
+			parameters = append(parameters, t.text)
+		} else {
+			parameter, err := p.cqlType(keyspace)
+			if err != nil {
+				return "", err
+			}
+			parameters = append(parameters, parameter)
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(">"); err != nil {
+		return "", err
+	}
+
+	return name + "<" + strings.Join(parameters, ", ") + ">", nil
+}
+
+// options reads a WITH clause into option names and rendered values.
+func (p *parser) options() (map[string]string, error) {
+	options := make(map[string]string)
+	for {
+		switch {
+		case p.acceptKeyword("CLUSTERING", "ORDER", "BY"):
+			start := p.pos
+			if err := p.skipParenthesized(); err != nil {
+				return nil, err
+			}
+			options[clusteringOrderOption] = render(p.tokens[start:p.pos], true)
+		case p.acceptKeyword("COMPACT", "STORAGE"):
+			options[compactStorageOption] = ""
+		default:
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol("="); err != nil {
+				return nil, err
+			}
+			start := p.pos
+			for !p.done() && !p.isKeyword("AND") {
+				if err := p.skipValue(); err != nil {
+					return nil, err
+				}
+			}
+			if start == p.pos {
+				return nil, p.unexpected("option value")
+			}
+			options[name] = render(p.tokens[start:p.pos], true)
+		}
+		if !p.acceptKeyword("AND") {
+			return options, p.expectDone()
+		}
+	}
+}
+
+// skipValue skips one token, or a bracketed group including its contents.
+func (p *parser) skipValue() error {
+	if p.isSymbol("(") || p.isSymbol("{") || p.isSymbol("[") {
+		return p.skipParenthesized()
+	}
+	p.pos++
+	return nil
+}
+
+// skipParenthesized skips a group opened by (, { or [ up to its closing symbol.
+func (p *parser) skipParenthesized() error {
+	closing := map[string]string{"(": ")", "{": "}", "[": "]"}
+	t, ok := p.peek()
+	if !ok || t.kind != tokenSymbol || closing[t.text] == "" {
+		return p.unexpected("(")
+	}
+	stack := make([]string, 0, 2)
+	for ; p.pos < len(p.tokens); p.pos++ {
+		t := p.tokens[p.pos]
+		if t.kind != tokenSymbol {
+			continue
+		}
+		if closer, ok := closing[t.text]; ok {
+			stack = append(stack, closer)
+			continue
+		}
+		if len(stack) > 0 && t.text == stack[len(stack)-1] {
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				p.pos++
+				return nil
+			}
+		}
+	}
+
+	return p.unexpected(stack[len(stack)-1])
+}
+
+// rest renders the remaining tokens without the final semicolon.
+func (p *parser) rest() string {
+	end := len(p.tokens)
+	if end > p.pos && p.tokens[end-1].kind == tokenSymbol && p.tokens[end-1].text == ";" {
+		end--
+	}
+	start := p.pos
+	p.pos = len(p.tokens)
+
+	return render(p.tokens[start:end], false)
+}
+
+// render joins tokens back into CQL. With lower set, unquoted identifiers are
+// lower cased, as CQL compares them case insensitively.
+func render(tokens []token, lower bool) string {
+	var out strings.Builder
+	for i, t := range tokens {
+		text := t.text
+		switch t.kind {
+		case tokenString:
+			text = "'" + strings.ReplaceAll(text, "'", "''") + "'"
+		case tokenQuotedIdentifier:
+			text = `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+		case tokenIdentifier:
+			if lower {
+				text = strings.ToLower(text)
+			}
+		}
+		if i > 0 && spaced(tokens[i-1], t) {
+			out.WriteByte(' ')
+		}
+		out.WriteString(text)
+	}
+
+	return out.String()
+}
+
+func spaced(previous, current token) bool {
+	if current.kind == tokenSymbol && slices.Contains([]string{",", ")", "]", "}", ".", ":", ">", ";"}, current.text) {
+		return false
+	}
+	return previous.kind != tokenSymbol || !slices.Contains([]string{"(", "[", "{", ".", "<"}, previous.text)
+}
+
+// typeReferences returns the user defined types used by a canonical type.
+func typeReferences(cqlType string) []string {
+	tokens, err := tokenize(cqlType)
+	if err != nil {
+		return nil
+	}
+	references := make([]string, 0)
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenQuotedIdentifier:
+			references = append(references, t.text)
+		case tokenIdentifier:
+			if !nativeTypes[t.text] && !parameterizedTypes[t.text] {
+				references = append(references, t.text)
+			}
+		}
+	}
+
+	return references
+}
@@ -0,0 +1,420 @@
+// Package schema simulates the effect of CQL statements on an in-memory
+// Cassandra schema, so migrations can be validated without a cluster.
+//
+// Apply parses keyspace, table, type, index, materialized view, function and
+// aggregate statements and reports semantic errors such as "table already
+// exists", "column not found" or "cannot drop primary key column". Data
+// statements are only checked against the tables and columns they reference,
+// other statements are ignored.
+package schema
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Schema is an in-memory model of the keyspaces of a cluster.
+type Schema struct {
+	// Keyspace is the current keyspace for unqualified names, as set by USE.
+	Keyspace  string               `json:"keyspace"`
+	Keyspaces map[string]*Keyspace `json:"keyspaces"`
+}
+
+// Keyspace holds the schema elements of one keyspace.
+type Keyspace struct {
+	Name string `json:"name"`
+	// Options holds the WITH clause, empty for the keyspace passed to New.
+	Options    map[string]string    `json:"options,omitempty"`
+	Tables     map[string]*Table    `json:"tables"`
+	Types      map[string]*Type     `json:"types"`
+	Indexes    map[string]*Index    `json:"indexes"`
+	Views      map[string]*View     `json:"views"`
+	Functions  map[string]*Function `json:"functions"`
+	Aggregates map[string]*Function `json:"aggregates"`
+}
+
+// Table is a table with its columns and primary key.
+type Table struct {
+	Name          string            `json:"name"`
+	Columns       []Column          `json:"columns"`
+	PartitionKey  []string          `json:"partition_key"`
+	ClusteringKey []string          `json:"clustering_key"`
+	Options       map[string]string `json:"options,omitempty"`
+}
+
+// Column is a table column or a user defined type field.
+type Column struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Static bool   `json:"static,omitempty"`
+}
+
+// Type is a user defined type.
+type Type struct {
+	Name   string   `json:"name"`
+	Fields []Column `json:"fields"`
+}
+
+// Index is a secondary index.
+type Index struct {
+	Name   string `json:"name"`
+	Table  string `json:"table"`
+	Target string `json:"target"`
+	// Using holds the index class of custom indexes.
+	Using string `json:"using,omitempty"`
+}
+
+// View is a materialized view.
+type View struct {
+	Name          string            `json:"name"`
+	BaseTable     string            `json:"base_table"`
+	Columns       []string          `json:"columns"`
+	PartitionKey  []string          `json:"partition_key"`
+	ClusteringKey []string          `json:"clustering_key"`
+	Where         string            `json:"where,omitempty"`
+	Options       map[string]string `json:"options,omitempty"`
+}
+
+// Function is a user defined function or aggregate, keyed by its signature.
+type Function struct {
+	Name      string   `json:"name"`
+	Arguments []string `json:"arguments"`
+	// Definition holds the rest of the CREATE statement after the argument list.
+	Definition string `json:"definition"`
+}
+
+// New returns an empty schema whose current keyspace is keyspace, which is
+// assumed to exist like the keyspace of a migration connection.
+func New(keyspace string) *Schema {
+	s := &Schema{Keyspaces: make(map[string]*Keyspace)}
+	if keyspace != "" {
+		s.Keyspace = normalizeName(keyspace)
+		s.Keyspaces[s.Keyspace] = newKeyspace(s.Keyspace, nil)
+	}
+
+	return s
+}
+
+func newKeyspace(name string, options map[string]string) *Keyspace {
+	return &Keyspace{
+		Name:       name,
+		Options:    options,
+		Tables:     make(map[string]*Table),
+		Types:      make(map[string]*Type),
+		Indexes:    make(map[string]*Index),
+		Views:      make(map[string]*View),
+		Functions:  make(map[string]*Function),
+		Aggregates: make(map[string]*Function),
+	}
+}
+
+// Clone returns a deep copy of s.
+func (s *Schema) Clone() *Schema {
+	clone := &Schema{Keyspace: s.Keyspace, Keyspaces: make(map[string]*Keyspace, len(s.Keyspaces))}
+	for name, keyspace := range s.Keyspaces {
+		copied := newKeyspace(keyspace.Name, maps.Clone(keyspace.Options))
+		for key, table := range keyspace.Tables {
+			t := *table
+			t.Columns = slices.Clone(table.Columns)
+			t.PartitionKey = slices.Clone(table.PartitionKey)
+			t.ClusteringKey = slices.Clone(table.ClusteringKey)
+			t.Options = maps.Clone(table.Options)
+			copied.Tables[key] = &t
+		}
+		for key, udt := range keyspace.Types {
+			u := *udt
+			u.Fields = slices.Clone(udt.Fields)
+			copied.Types[key] = &u
+		}
+		for key, index := range keyspace.Indexes {
+			i := *index
+			copied.Indexes[key] = &i
+		}
+		for key, view := range keyspace.Views {
+			v := *view
+			v.Columns = slices.Clone(view.Columns)
+			v.PartitionKey = slices.Clone(view.PartitionKey)
+			v.ClusteringKey = slices.Clone(view.ClusteringKey)
+			v.Options = maps.Clone(view.Options)
+			copied.Views[key] = &v
+		}
+		for key, function := range keyspace.Functions {
+			f := *function
+			f.Arguments = slices.Clone(function.Arguments)
+			copied.Functions[key] = &f
+		}
+		for key, aggregate := range keyspace.Aggregates {
+			a := *aggregate
+			a.Arguments = slices.Clone(aggregate.Arguments)
+			copied.Aggregates[key] = &a
+		}
+		clone.Keyspaces[name] = copied
+	}
+
+	return clone
+}
+
+// Column returns the column with the given name, or nil.
+func (t *Table) Column(name string) *Column {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+
+	return nil
+}
+
+// IsPrimaryKey reports whether column is part of the primary key.
+func (t *Table) IsPrimaryKey(column string) bool {
+	return slices.Contains(t.PartitionKey, column) || slices.Contains(t.ClusteringKey, column)
+}
+
+// Object is one schema element with its CREATE statement.
+type Object struct {
+	// Kind is keyspace, type, table, index, view, function or aggregate.
+	Kind string
+	// Name is the qualified name, including the argument types of functions
+	// and aggregates.
+	Name string
+	CQL  string
+}
+
+var dropKeywords = map[string]string{
+	"keyspace": "KEYSPACE", "type": "TYPE", "table": "TABLE", "index": "INDEX",
+	"view": "MATERIALIZED VIEW", "function": "FUNCTION", "aggregate": "AGGREGATE",
+}
+
+// Drop returns the statement that drops o. Dropping the objects of Objects in
+// reverse order removes every type after the types and tables using it.
+func (o Object) Drop() string {
+	name := o.Name
+	if o.Kind == "keyspace" {
+		name = quoteName(name)
+	}
+	return fmt.Sprintf("DROP %s %s;", dropKeywords[o.Kind], name)
+}
+
+// Objects returns the elements of s in a stable order, with every type
+// before the types and tables using it.
+func (s *Schema) Objects() []Object {
+	objects := make([]Object, 0)
+	for _, name := range sortedKeys(s.Keyspaces) {
+		keyspace := s.Keyspaces[name]
+		qualify := func(object string) string {
+			return quoteName(name) + "." + quoteName(object)
+		}
+		if len(keyspace.Options) > 0 {
+			objects = append(objects, Object{Kind: "keyspace", Name: name, CQL: fmt.Sprintf("CREATE KEYSPACE %s WITH %s;", quoteName(name), renderOptions(keyspace.Options))})
+		}
+		for _, udt := range sortedTypes(keyspace) {
+			fields := make([]string, 0, len(udt.Fields))
+			for _, field := range udt.Fields {
+				fields = append(fields, "    "+quoteName(field.Name)+" "+field.Type)
+			}
+			objects = append(objects, Object{Kind: "type", Name: qualify(udt.Name), CQL: fmt.Sprintf("CREATE TYPE %s (\n%s\n);", qualify(udt.Name), strings.Join(fields, ",\n"))})
+		}
+		for _, key := range sortedKeys(keyspace.Tables) {
+			objects = append(objects, Object{Kind: "table", Name: qualify(key), CQL: tableCQL(qualify(key), keyspace.Tables[key])})
+		}
+		for _, key := range sortedKeys(keyspace.Indexes) {
+			index := keyspace.Indexes[key]
+			statement := fmt.Sprintf("CREATE INDEX %s ON %s (%s);", quoteName(index.Name), qualify(index.Table), index.Target)
+			if index.Using != "" {
+				statement = fmt.Sprintf("CREATE CUSTOM INDEX %s ON %s (%s) USING '%s';", quoteName(index.Name), qualify(index.Table), index.Target, index.Using)
+			}
+			objects = append(objects, Object{Kind: "index", Name: qualify(key), CQL: statement})
+		}
+		for _, key := range sortedKeys(keyspace.Views) {
+			objects = append(objects, Object{Kind: "view", Name: qualify(key), CQL: viewCQL(qualify(key), qualify(keyspace.Views[key].BaseTable), keyspace.Views[key])})
+		}
+		for _, key := range sortedKeys(keyspace.Functions) {
+			function := keyspace.Functions[key]
+			statement := fmt.Sprintf("CREATE FUNCTION %s (%s) %s;", qualify(function.Name), strings.Join(function.Arguments, ", "), function.Definition)
+			objects = append(objects, Object{Kind: "function", Name: name + "." + key, CQL: statement})
+		}
+		for _, key := range sortedKeys(keyspace.Aggregates) {
+			aggregate := keyspace.Aggregates[key]
+			statement := fmt.Sprintf("CREATE AGGREGATE %s (%s) %s;", qualify(aggregate.Name), strings.Join(aggregate.Arguments, ", "), aggregate.Definition)
+			objects = append(objects, Object{Kind: "aggregate", Name: name + "." + key, CQL: statement})
+		}
+	}
+
+	return objects
+}
+
+// CQL renders s as CREATE statements in a stable order, so two schemas are
+// equal when their CQL is equal. Regular columns are sorted by name like in
+// DESCRIBE output, as Cassandra does not keep their declaration order.
+func (s *Schema) CQL() string {
+	var out strings.Builder
+	for _, object := range s.Objects() {
+		out.WriteString(object.CQL + "\n\n")
+	}
+
+	return out.String()
+}
+
+func tableCQL(name string, table *Table) string {
+	lines := make([]string, 0, len(table.Columns)+1)
+	for _, column := range orderedColumns(table) {
+		line := "    " + quoteName(column.Name) + " " + column.Type
+		if column.Static {
+			line += " static"
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "    PRIMARY KEY ("+primaryKey(table.PartitionKey, table.ClusteringKey)+")")
+	statement := fmt.Sprintf("CREATE TABLE %s (\n%s\n)", name, strings.Join(lines, ",\n"))
+	if len(table.Options) > 0 {
+		statement += " WITH " + renderOptions(table.Options)
+	}
+
+	return statement + ";"
+}
+
+func viewCQL(name, baseTable string, view *View) string {
+	columns := make([]string, 0, len(view.Columns))
+	for _, column := range view.Columns {
+		columns = append(columns, quoteName(column))
+	}
+	slices.Sort(columns)
+	statement := fmt.Sprintf("CREATE MATERIALIZED VIEW %s AS\n    SELECT %s FROM %s\n", name, strings.Join(columns, ", "), baseTable)
+	if view.Where != "" {
+		statement += "    WHERE " + view.Where + "\n"
+	}
+	statement += "    PRIMARY KEY (" + primaryKey(view.PartitionKey, view.ClusteringKey) + ")"
+	if len(view.Options) > 0 {
+		statement += " WITH " + renderOptions(view.Options)
+	}
+
+	return statement + ";"
+}
+
+// orderedColumns returns the partition key, clustering and regular columns
+// of table, each group in key order and the regular columns sorted by name.
+func orderedColumns(table *Table) []Column {
+	columns := make([]Column, 0, len(table.Columns))
+	for _, name := range table.PartitionKey {
+		columns = append(columns, *table.Column(name))
+	}
+	for _, name := range table.ClusteringKey {
+		columns = append(columns, *table.Column(name))
+	}
+	regular := make([]Column, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		if !table.IsPrimaryKey(column.Name) {
+			regular = append(regular, column)
+		}
+	}
+	slices.SortFunc(regular, func(left, right Column) int {
+		return strings.Compare(left.Name, right.Name)
+	})
+
+	return append(columns, regular...)
+}
+
+// renderOptions renders a WITH clause in option name order.
+func renderOptions(options map[string]string) string {
+	rendered := make([]string, 0, len(options))
+	for _, name := range sortedKeys(options) {
+		switch name {
+		case compactStorageOption:
+			rendered = append(rendered, strings.ToUpper(name))
+		case clusteringOrderOption:
+			rendered = append(rendered, strings.ToUpper(name)+" "+options[name])
+		default:
+			rendered = append(rendered, name+" = "+options[name])
+		}
+	}
+
+	return strings.Join(rendered, " AND ")
+}
+
+func primaryKey(partitionKey, clusteringKey []string) string {
+	partition := make([]string, 0, len(partitionKey))
+	for _, name := range partitionKey {
+		partition = append(partition, quoteName(name))
+	}
+	key := strings.Join(partition, ", ")
+	if len(partition) > 1 {
+		key = "(" + key + ")"
+	}
+	for _, name := range clusteringKey {
+		key += ", " + quoteName(name)
+	}
+
+	return key
+}
+
+// sortedTypes returns the types of keyspace by name, with every type after
+// the types it uses.
+func sortedTypes(keyspace *Keyspace) []*Type {
+	sorted := make([]*Type, 0, len(keyspace.Types))
+	written := make(map[string]bool, len(keyspace.Types))
+	var visit func(name string)
+	visit = func(name string) {
+		udt, ok := keyspace.Types[name]
+		if !ok || written[name] {
+			return
+		}
+		written[name] = true
+		for _, field := range udt.Fields {
+			for _, used := range typeReferences(field.Type) {
+				visit(used)
+			}
+		}
+		sorted = append(sorted, udt)
+	}
+	for _, name := range sortedKeys(keyspace.Types) {
+		visit(name)
+	}
+
+	return sorted
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+var plainName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// quoteName quotes name unless it is a plain lower case identifier.
+func quoteName(name string) string {
+	if plainName.MatchString(name) && !reservedWords[strings.ToUpper(name)] {
+		return name
+	}
+
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// normalizeName lower cases an unquoted identifier and unquotes a quoted one.
+func normalizeName(name string) string {
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+
+	return strings.ToLower(name)
+}
+
+var reservedWords = map[string]bool{
+	"ADD": true, "ALLOW": true, "ALTER": true, "AND": true, "APPLY": true, "ASC": true,
+	"AUTHORIZE": true, "BATCH": true, "BEGIN": true, "BY": true, "COLUMNFAMILY": true,
+	"CREATE": true, "DELETE": true, "DESC": true, "DESCRIBE": true, "DROP": true,
+	"ENTRIES": true, "EXECUTE": true, "FROM": true, "FULL": true, "GRANT": true, "IF": true,
+	"IN": true, "INDEX": true, "INFINITY": true, "INSERT": true, "INTO": true, "KEYSPACE": true,
+	"LIMIT": true, "MODIFY": true, "NAN": true, "NORECURSIVE": true, "NOT": true, "NULL": true,
+	"OF": true, "ON": true, "OR": true, "ORDER": true, "PRIMARY": true, "RENAME": true,
+	"REPLACE": true, "REVOKE": true, "SCHEMA": true, "SELECT": true, "SET": true, "TABLE": true,
+	"TO": true, "TOKEN": true, "TRUNCATE": true, "UNLOGGED": true, "UPDATE": true, "USE": true,
+	"USING": true, "VIEW": true, "WHERE": true, "WITH": true,
+}
@@ -0,0 +1,213 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func applyAll(t *testing.T, s *Schema, statements ...string) {
+	t.Helper()
+	for _, statement := range statements {
+		require.NoError(t, s.Apply(statement), statement)
+	}
+}
+
+func TestApply_CreateTable(t *testing.T) {
+	s := New("bloodlab")
+	applyAll(t, s,
+		"CREATE TYPE address (street text, city text);",
+		`CREATE TABLE IF NOT EXISTS bloodlab.Users (
+  user_id UUID,
+  "createdAt" timestamp,
+  email varchar,
+  home frozen<address>,
+  tags set<text>,
+  PRIMARY KEY ((user_id), "createdAt")
+) WITH CLUSTERING ORDER BY ("createdAt" DESC) AND comment = 'users';`,
+	)
+
+	table := s.Keyspaces["bloodlab"].Tables["users"]
+	require.NotNil(t, table)
+	assert.Equal(t, []string{"user_id"}, table.PartitionKey)
+	assert.Equal(t, []string{"createdAt"}, table.ClusteringKey)
+	assert.Equal(t, "text", table.Column("email").Type)
+	assert.Equal(t, "frozen<address>", table.Column("home").Type)
+	assert.Equal(t, `("createdAt" desc)`, table.Options["clustering order by"])
+	assert.Equal(t, "'users'", table.Options["comment"])
+}
+
+func TestApply_SemanticErrors(t *testing.T) {
+	tests := []struct {
+		statement string
+		err       string
+	}{
+		{statement: "CREATE TABLE users (id uuid PRIMARY KEY, name text);", err: "table bloodlab.users already exists"},
+		{statement: "CREATE TABLE orders (id uuid, total int);", err: "table bloodlab.orders has no primary key"},
+		{statement: "CREATE TABLE orders (id uuid PRIMARY KEY, id int);", err: "duplicate column id in table bloodlab.orders"},
+		{statement: "CREATE TABLE orders (id uuid PRIMARY KEY, home address);", err: "type address not found in keyspace bloodlab"},
+		{statement: "CREATE TABLE other.orders (id uuid PRIMARY KEY);", err: "keyspace other not found"},
+		{statement: "ALTER TABLE users DROP id;", err: "cannot drop primary key column id of table bloodlab.users"},
+		{statement: "ALTER TABLE users DROP age;", err: "column age not found in table bloodlab.users"},
+		{statement: "ALTER TABLE users ADD name text;", err: "column name already exists in table bloodlab.users"},
+		{statement: "ALTER TABLE users RENAME name TO full_name;", err: "cannot rename non primary key column name of table bloodlab.users"},
+		{statement: "ALTER TABLE orders ADD total int;", err: "table bloodlab.orders not found"},
+		{statement: "CREATE INDEX ON users (age);", err: "column age not found in table bloodlab.users"},
+		{statement: "DROP INDEX users_email_idx;", err: "index users_email_idx not found in keyspace bloodlab"},
+		{statement: "INSERT INTO users (id, age) VALUES (uuid(), 3);", err: "column age not found in table users"},
+		{statement: "CREATE MATERIALIZED VIEW users_by_name AS SELECT * FROM users WHERE name IS NOT NULL PRIMARY KEY (name);", err: "primary key of materialized view bloodlab.users_by_name must include all primary key columns of users, missing: id"},
+		{statement: "CREATE TABLE orders (id uuid PRIMARY KEY", err: "syntax error: expected ) at end of statement"},
+	}
+
+	for _, test := range tests {
+		s := New("bloodlab")
+		applyAll(t, s, "CREATE TABLE users (id uuid PRIMARY KEY, name text);")
+		before := s.CQL()
+		assert.EqualError(t, s.Apply(test.statement), test.err, test.statement)
+		assert.Equal(t, before, s.CQL(), test.statement)
+	}
+}
+
+func TestApply_DependentObjects(t *testing.T) {
+	s := New("bloodlab")
+	applyAll(t, s,
+		"CREATE TYPE address (street text);",
+		"CREATE TABLE users (id uuid PRIMARY KEY, email text, home frozen<address>);",
+		"CREATE INDEX users_email ON users (email);",
+		"CREATE MATERIALIZED VIEW users_by_email AS SELECT id, email FROM users WHERE email IS NOT NULL AND id IS NOT NULL PRIMARY KEY (email, id);",
+	)
+
+	assert.EqualError(t, s.Apply("DROP TYPE address;"), "cannot drop type bloodlab.address, it is used by table users")
+	assert.EqualError(t, s.Apply("DROP TABLE users;"), "cannot drop table bloodlab.users with materialized views: users_by_email")
+	assert.EqualError(t, s.Apply("ALTER TABLE users DROP home;"), "cannot drop column home of table bloodlab.users with materialized views: users_by_email")
+	assert.EqualError(t, s.Apply("INSERT INTO users_by_email (email, id) VALUES ('a', uuid());"), "cannot write to materialized view users_by_email")
+
+	applyAll(t, s, "DROP MATERIALIZED VIEW users_by_email;", "DROP TABLE users;", "DROP TYPE address;")
+	assert.Empty(t, s.Keyspaces["bloodlab"].Indexes)
+	assert.Empty(t, s.CQL())
+}
+
+func TestApply_Functions(t *testing.T) {
+	s := New("bloodlab")
+	applyAll(t, s,
+		"CREATE FUNCTION add_one (value int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS 'return value + 1;';",
+		"CREATE OR REPLACE FUNCTION add_one (value int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS $$return value + 2;$$;",
+		"CREATE AGGREGATE total (int) SFUNC add_one STYPE int INITCOND 0;",
+	)
+
+	assert.EqualError(t, s.Apply("CREATE FUNCTION add_one (value int) RETURNS int LANGUAGE java AS 'return 1;';"), "function bloodlab.add_one(int) already exists")
+	assert.EqualError(t, s.Apply("CREATE AGGREGATE broken (int) SFUNC missing STYPE int;"), "function missing not found in keyspace bloodlab")
+	assert.Contains(t, s.CQL(), "CREATE FUNCTION bloodlab.add_one (value int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS 'return value + 2;';")
+
+	applyAll(t, s, "DROP AGGREGATE total;", "DROP FUNCTION add_one(int);")
+	assert.Empty(t, s.CQL())
+}
+
+func TestObject_Drop(t *testing.T) {
+	s := New("bloodlab")
+	applyAll(t, s,
+		"CREATE KEYSPACE archive WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1};",
+		"CREATE TYPE address (street text);",
+		"CREATE TABLE users (id uuid PRIMARY KEY, email text, home frozen<address>);",
+		"CREATE INDEX users_email ON users (email);",
+		"CREATE MATERIALIZED VIEW users_by_email AS SELECT id, email FROM users WHERE email IS NOT NULL AND id IS NOT NULL PRIMARY KEY (email, id);",
+		"CREATE FUNCTION add_one (value int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS 'return value + 1;';",
+		"CREATE AGGREGATE total (int) SFUNC add_one STYPE int INITCOND 0;",
+	)
+
+	objects := s.Objects()
+	drops := make([]string, 0, len(objects))
+	for i := len(objects) - 1; i >= 0; i-- {
+		drops = append(drops, objects[i].Drop())
+	}
+	assert.Equal(t, []string{
+		"DROP AGGREGATE bloodlab.total(int);",
+		"DROP FUNCTION bloodlab.add_one(int);",
+		"DROP MATERIALIZED VIEW bloodlab.users_by_email;",
+		"DROP INDEX bloodlab.users_email;",
+		"DROP TABLE bloodlab.users;",
+		"DROP TYPE bloodlab.address;",
+		"DROP KEYSPACE archive;",
+	}, drops)
+
+	applyAll(t, s, drops...)
+	assert.Empty(t, s.CQL())
+}
+
+func TestIsSchemaStatement(t *testing.T) {
+	for _, statement := range []string{
+		"USE bloodlab;",
+		"CREATE TABLE IF NOT EXISTS users (id uuid PRIMARY KEY);",
+		"create or replace function f (v int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS 'return v;';",
+		"CREATE CUSTOM INDEX users_email ON users (email) USING 'StorageAttachedIndex';",
+		"ALTER TABLE users ADD email text;",
+		"DROP MATERIALIZED VIEW users_by_email;",
+	} {
+		assert.True(t, IsSchemaStatement(statement), statement)
+	}
+	for _, statement := range []string{
+		"INSERT INTO users (id) VALUES (uuid());",
+		"UPDATE users SET email = 'a' WHERE id = 1;",
+		"TRUNCATE users;",
+		"GRANT SELECT ON KEYSPACE bloodlab TO reader;",
+		"CREATE ROLE reader WITH LOGIN = true;",
+		"DROP USER legacy;",
+		"'unterminated",
+	} {
+		assert.False(t, IsSchemaStatement(statement), statement)
+	}
+}
+
+func TestApply_RenameAndAlter(t *testing.T) {
+	s := New("bloodlab")
+	applyAll(t, s,
+		"CREATE TABLE events (day date, at timestamp, kind text, PRIMARY KEY (day, at));",
+		"ALTER TABLE events RENAME at TO happened_at;",
+		"ALTER TABLE events ADD (source text, payload blob);",
+		"ALTER TABLE events DROP (payload);",
+		"ALTER TABLE events WITH gc_grace_seconds = 3600;",
+	)
+
+	assert.Equal(t, `CREATE TABLE bloodlab.events (
+    day date,
+    happened_at timestamp,
+    kind text,
+    source text,
+    PRIMARY KEY (day, happened_at)
+) WITH gc_grace_seconds = 3600;
+
+`, s.CQL())
+}
+
+func TestApply_IgnoresOtherStatements(t *testing.T) {
+	s := New("bloodlab")
+
+	assert.NoError(t, s.Apply("CREATE ROLE migrator WITH LOGIN = true;"))
+	assert.NoError(t, s.Apply("GRANT SELECT ON KEYSPACE bloodlab TO migrator;"))
+	assert.EqualError(t, s.Apply("SELECT * FROM users;"), "table bloodlab.users not found")
+}
+
+func TestSchema_CloneIsIndependent(t *testing.T) {
+	s := New("bloodlab")
+	applyAll(t, s, "CREATE TABLE users (id uuid PRIMARY KEY, name text);")
+	clone := s.Clone()
+	applyAll(t, clone, "ALTER TABLE users ADD email text;")
+
+	assert.Nil(t, s.Keyspaces["bloodlab"].Tables["users"].Column("email"))
+	assert.NotEqual(t, s.CQL(), clone.CQL())
+}
+
+func TestTokenize(t *testing.T) {
+	tokens, err := tokenize(`SELECT "Name", 'it''s' -- comment
+/* block */ FROM t;`)
+	require.NoError(t, err)
+	texts := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		texts = append(texts, token.text)
+	}
+	assert.Equal(t, []string{"SELECT", "Name", ",", "it's", "FROM", "t", ";"}, texts)
+
+	_, err = tokenize("SELECT 'open")
+	assert.EqualError(t, err, "unterminated ' quote")
+}
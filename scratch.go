@@ -0,0 +1,156 @@
+package migrate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultScratchPrefix prefixes scratch keyspace names unless
+// ScratchOptions.Prefix is set.
+const DefaultScratchPrefix = "scratch"
+
+// ScratchOptions configures WithScratchKeyspace.
+type ScratchOptions struct {
+	// Prefix of the generated keyspace name, DefaultScratchPrefix when empty.
+	Prefix string
+	// Replication is the replication map of the keyspace, e.g.
+	// {"class": "NetworkTopologyStrategy", "dc1": "3"}. It defaults to
+	// SimpleStrategy with a replication factor of 1.
+	Replication map[string]string
+	// Connect opens the sessions of WithScratchKeyspace, one with an empty
+	// conf.Keyspace for creating and dropping the keyspace and one connected
+	// to it. It defaults to connecting to conf.Connection, e.g. a
+	// migratetest.Session can be returned instead.
+	Connect func(conf Config) (Session, error)
+}
+
+// ScratchKeyspace is a migrated keyspace that exists for the duration of a
+// WithScratchKeyspace callback.
+type ScratchKeyspace struct {
+	Name string
+	// Session is connected to the keyspace. It is closed when the callback
+	// returns.
+	Session Session
+	// Up is the result of applying the migrations to the keyspace.
+	Up UpResult
+}
+
+// WithScratchKeyspace creates a uniquely named keyspace, applies the
+// migrations of conf.MigrationDir to it and calls fn with a session
+// connected to it. The keyspace is dropped afterwards, also when the
+// migrations or fn fail or fn panics. conf.Keyspace and conf.Session are
+// ignored, the cluster is reached with conf.Connection or opts.Connect. The
+// migrations are tracked in the scratch keyspace, whatever MigrationKeyspace
+// and MigrationTable say, and run without protection or shell hooks.
+func WithScratchKeyspace(conf Config, opts ScratchOptions, fn func(scratch ScratchKeyspace) error) error {
+	return WithScratchKeyspaceContext(context.Background(), conf, opts, fn)
+}
+
+// WithScratchKeyspaceContext is WithScratchKeyspace with a context. The
+// keyspace is dropped even when ctx is canceled.
+func WithScratchKeyspaceContext(ctx context.Context, conf Config, opts ScratchOptions, fn func(scratch ScratchKeyspace) error) (err error) {
+	name, err := scratchKeyspaceName(opts.Prefix)
+	if err != nil {
+		return err
+	}
+	replication := opts.Replication
+	if len(replication) == 0 {
+		replication = map[string]string{"class": "SimpleStrategy", "replication_factor": "1"}
+	}
+	connect := opts.Connect
+	if connect == nil {
+		connect = connectScratch
+	}
+	logger := conf.logger().With("keyspace", name)
+
+	adminConf := conf
+	adminConf.Keyspace = ""
+	adminConf.Session = nil
+	admin, err := connect(adminConf)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	if err := admin.Exec(ctx, fmt.Sprintf("CREATE KEYSPACE %s WITH replication = %s", name, replicationMap(replication))); err != nil {
+		return fmt.Errorf("creating scratch keyspace %s: %w", name, err)
+	}
+	logger.Info("created scratch keyspace")
+	defer func() {
+		dropErr := admin.Exec(context.WithoutCancel(ctx), "DROP KEYSPACE IF EXISTS "+name)
+		if dropErr != nil {
+			logger.Error("dropping scratch keyspace failed", "error", dropErr)
+			err = errors.Join(err, fmt.Errorf("dropping scratch keyspace %s: %w", name, dropErr))
+			return
+		}
+		logger.Info("dropped scratch keyspace")
+	}()
+
+	scratchConf := conf
+	scratchConf.Keyspace = name
+	scratchConf.MigrationKeyspace = ""
+	scratchConf.MigrationTable = ""
+	scratchConf.Protected = false
+	scratchConf.ShellHooks = ShellHooks{}
+	scratchConf.Session = nil
+	session, err := connect(scratchConf)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	scratchConf.Session = session
+	up, err := ApplyUpContext(ctx, scratchConf)
+	if err != nil {
+		return err
+	}
+
+	return fn(ScratchKeyspace{Name: name, Session: session, Up: up})
+}
+
+func connectScratch(conf Config) (Session, error) {
+	session, err := Connect(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSession(session), nil
+}
+
+// scratchKeyspaceName returns prefix followed by the current time and a
+// random suffix, within the 48 characters Cassandra allows.
+func scratchKeyspaceName(prefix string) (string, error) {
+	if prefix == "" {
+		prefix = DefaultScratchPrefix
+	}
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	name := strings.ToLower(fmt.Sprintf("%s_%s_%s", prefix, time.Now().UTC().Format("20060102150405"), hex.EncodeToString(random)))
+	if len(name) > 48 {
+		return "", fmt.Errorf("scratch keyspace name %s is longer than 48 characters", name)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+			return "", fmt.Errorf("scratch keyspace prefix %q may only contain letters, digits and underscores", prefix)
+		}
+	}
+
+	return name, nil
+}
+
+// replicationMap renders replication as a CQL map literal.
+func replicationMap(replication map[string]string) string {
+	entries := make([]string, 0, len(replication))
+	for _, key := range slices.Sorted(maps.Keys(replication)) {
+		entries = append(entries, fmt.Sprintf("'%s': '%s'", strings.ReplaceAll(key, "'", "''"), strings.ReplaceAll(replication[key], "'", "''")))
+	}
+
+	return "{" + strings.Join(entries, ", ") + "}"
+}
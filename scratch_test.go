@@ -0,0 +1,32 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScratchKeyspaceName(t *testing.T) {
+	name, err := scratchKeyspaceName("")
+	require.NoError(t, err)
+	assert.Regexp(t, `^scratch_\d{14}_[0-9a-f]{8}$`, name)
+
+	other, err := scratchKeyspaceName("")
+	require.NoError(t, err)
+	assert.NotEqual(t, name, other)
+
+	name, err = scratchKeyspaceName("Bloodlab_IT")
+	require.NoError(t, err)
+	assert.Regexp(t, `^bloodlab_it_`, name)
+
+	_, err = scratchKeyspaceName("blood-lab")
+	assert.EqualError(t, err, `scratch keyspace prefix "blood-lab" may only contain letters, digits and underscores`)
+	_, err = scratchKeyspaceName("a_very_long_prefix_for_a_keyspace")
+	assert.ErrorContains(t, err, "is longer than 48 characters")
+}
+
+func TestReplicationMap(t *testing.T) {
+	assert.Equal(t, "{'class': 'NetworkTopologyStrategy', 'dc1': '3', 'dc2': '2'}",
+		replicationMap(map[string]string{"dc2": "2", "class": "NetworkTopologyStrategy", "dc1": "3"}))
+}
@@ -0,0 +1,63 @@
+package migrate
+
+import (
+	"context"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// Session runs the statements of a migration run. NewSession adapts a
+// *gocql.Session; package migratetest provides an in-memory fake.
+type Session interface {
+	Exec(ctx context.Context, statement string, args ...any) error
+	Iter(ctx context.Context, statement string, args ...any) Iter
+	Close()
+}
+
+// Iter iterates over the rows of a query, like *gocql.Iter.
+type Iter interface {
+	Scan(dest ...any) bool
+	Close() error
+}
+
+// NewSession adapts a gocql session to Session.
+func NewSession(session *gocql.Session) Session {
+	return gocqlSession{session: session}
+}
+
+type gocqlSession struct {
+	session *gocql.Session
+}
+
+func (s gocqlSession) Exec(ctx context.Context, statement string, args ...any) error {
+	return s.session.Query(statement, args...).ExecContext(ctx)
+}
+
+func (s gocqlSession) Iter(ctx context.Context, statement string, args ...any) Iter {
+	return s.session.Query(statement, args...).IterContext(ctx)
+}
+
+func (s gocqlSession) Close() {
+	s.session.Close()
+}
+
+// openSession returns conf.Session when set, otherwise it connects with
+// GetConnection. Closing the returned session leaves conf.Session open, as
+// it belongs to the caller.
+func openSession(conf Config) (Session, error) {
+	if conf.Session != nil {
+		return callerSession{Session: conf.Session}, nil
+	}
+	session, err := Connect(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSession(session), nil
+}
+
+type callerSession struct {
+	Session
+}
+
+func (callerSession) Close() {}
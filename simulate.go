@@ -0,0 +1,120 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/blutspende/cassandra-migrate/schema"
+	"github.com/blutspende/cassandra-migrate/sqlparse"
+)
+
+// SimulationError describes a statement that fails in Simulate or
+// VerifyRoundTrip.
+type SimulationError struct {
+	MigrationID string
+	Direction   Direction
+	// Line is the one based line of the migration file at which the
+	// statement starts.
+	Line      int
+	Statement string
+	Err       error
+}
+
+func (e *SimulationError) Error() string {
+	return fmt.Sprintf("%s:%d: %s: %s", e.MigrationID, e.Line, e.Direction, e.Err)
+}
+
+func (e *SimulationError) Unwrap() error {
+	return e.Err
+}
+
+// SimulationResult is the outcome of Simulate.
+type SimulationResult struct {
+	// Schema is the schema after all Up sections and repeatable migrations.
+	Schema *schema.Schema
+	// MigrationIDs holds the simulated migrations in order.
+	MigrationIDs []string
+	Errors       []*SimulationError
+}
+
+// Simulate validates the migrations of conf.MigrationDir without a cluster.
+// It applies their Up sections in order to an empty offline schema of
+// conf.Keyspace, followed by the repeatable migrations, and then the Down
+// sections in reverse order to a copy of the schema before the repeatable
+// migrations. Failing statements are collected and skipped, so later
+// statements are still checked. Env directives are evaluated for
+// conf.Environment.
+func Simulate(conf Config) (SimulationResult, error) {
+	migrationFiles, err := listMigrationFiles(conf)
+	if err != nil {
+		return SimulationResult{}, err
+	}
+	repeatableFiles, err := listRepeatableFiles(conf)
+	if err != nil {
+		return SimulationResult{}, err
+	}
+	migrations := make([]*sqlparse.ParsedMigration, 0, len(migrationFiles))
+	for _, file := range migrationFiles {
+		migration, err := parseMigrationFile(file)
+		if err != nil {
+			return SimulationResult{}, err
+		}
+		migrations = append(migrations, migration)
+	}
+
+	result := SimulationResult{Schema: schema.New(conf.Keyspace), MigrationIDs: make([]string, 0, len(migrationFiles))}
+	for i, migration := range migrations {
+		id := filepath.Base(migrationFiles[i])
+		result.MigrationIDs = append(result.MigrationIDs, id)
+		result.Errors = append(result.Errors, simulateStatements(result.Schema, id, DirectionUp, migration.UpStatementsFor(conf.Environment), migration.UpLines)...)
+	}
+	reverted := result.Schema.Clone()
+	for _, file := range repeatableFiles {
+		migration, err := parseMigrationFile(file)
+		if err != nil {
+			return SimulationResult{}, err
+		}
+		id := filepath.Base(file)
+		result.MigrationIDs = append(result.MigrationIDs, id)
+		result.Errors = append(result.Errors, simulateStatements(result.Schema, id, DirectionUp, migration.UpStatementsFor(conf.Environment), migration.UpLines)...)
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		id := filepath.Base(migrationFiles[i])
+		result.Errors = append(result.Errors, simulateStatements(reverted, id, DirectionDown, migrations[i].DownStatementsFor(conf.Environment), migrations[i].DownLines)...)
+	}
+
+	return result, nil
+}
+
+// simulateStatements applies statements to s and returns the failed ones.
+func simulateStatements(s *schema.Schema, migrationID string, direction Direction, statements []string, lines []int) []*SimulationError {
+	failed := make([]*SimulationError, 0)
+	for i, statement := range statements {
+		if err := s.Apply(statement); err != nil {
+			failed = append(failed, &SimulationError{
+				MigrationID: migrationID,
+				Direction:   direction,
+				Line:        lines[i],
+				Statement:   statement,
+				Err:         err,
+			})
+		}
+	}
+
+	return failed
+}
+
+func parseMigrationFile(file string) (*sqlparse.ParsedMigration, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	migration, err := sqlparse.ParseMigration(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+	}
+
+	return migration, nil
+}
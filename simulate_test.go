@@ -0,0 +1,60 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulate(t *testing.T) {
+	tempDir := t.TempDir()
+	writeMigrationFile(t, tempDir, "0001-create-users.cql", `-- +migrate Up
+CREATE TABLE users (
+  id uuid PRIMARY KEY,
+  email text
+);
+-- +migrate Down
+DROP TABLE users;
+`)
+	writeMigrationFile(t, tempDir, "0002-drop-id.cql", `-- +migrate Up
+ALTER TABLE users ADD name text;
+
+ALTER TABLE users DROP id;
+-- +migrate Down
+ALTER TABLE users DROP name;
+ALTER TABLE users DROP nickname;
+`)
+	writeMigrationFile(t, tempDir, "R-users-by-email.cql", `-- +migrate Up
+CREATE MATERIALIZED VIEW IF NOT EXISTS users_by_email AS
+  SELECT * FROM users WHERE email IS NOT NULL AND id IS NOT NULL
+  PRIMARY KEY (email, id);
+`)
+
+	result, err := Simulate(Config{Keyspace: "bloodlab", MigrationDir: tempDir})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"0001-create-users.cql", "0002-drop-id.cql", "R-users-by-email.cql"}, result.MigrationIDs)
+	require.Len(t, result.Errors, 2)
+	assert.EqualError(t, result.Errors[0], "0002-drop-id.cql:4: up: cannot drop primary key column id of table bloodlab.users")
+	assert.EqualError(t, result.Errors[1], "0002-drop-id.cql:7: down: column nickname not found in table bloodlab.users")
+	assert.Contains(t, result.Schema.CQL(), "CREATE MATERIALIZED VIEW bloodlab.users_by_email")
+	assert.NotNil(t, result.Schema.Keyspaces["bloodlab"].Tables["users"].Column("name"))
+}
+
+func TestSimulate_Env(t *testing.T) {
+	tempDir := t.TempDir()
+	writeMigrationFile(t, tempDir, "0001-seed.cql", `-- +migrate Env development
+-- +migrate Up
+INSERT INTO users (id) VALUES (uuid());
+`)
+
+	result, err := Simulate(Config{Keyspace: "bloodlab", MigrationDir: tempDir, Environment: "production"})
+	require.NoError(t, err)
+	assert.Empty(t, result.Errors)
+
+	result, err = Simulate(Config{Keyspace: "bloodlab", MigrationDir: tempDir, Environment: "development"})
+	require.NoError(t, err)
+	require.Len(t, result.Errors, 1)
+	assert.EqualError(t, result.Errors[0], "0001-seed.cql:3: up: table bloodlab.users not found")
+}
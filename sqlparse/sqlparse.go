@@ -15,6 +15,67 @@ const (
 type ParsedMigration struct {
 	UpStatements   []string
 	DownStatements []string
+	// UpLines and DownLines hold the one based line number at which each
+	// statement starts in the file.
+	UpLines   []int
+	DownLines []int
+	// Covers lists the migration IDs a squashed baseline replaces, declared
+	// with '-- +migrate Covers <id>...'.
+	Covers []string
+	// Envs, UpEnvs and DownEnvs restrict the migration, its Up section or its
+	// Down section to environments, declared with '-- +migrate Env <env>,...'
+	// before the first section or at the start of a section. Empty means all
+	// environments.
+	Envs     []string
+	UpEnvs   []string
+	DownEnvs []string
+	// Dangerous marks a migration that needs confirmation in protected
+	// environments, declared with '-- +migrate Dangerous [reason]'.
+	Dangerous       bool
+	DangerousReason string
+	// Undo maps the index of an Up statement to the statement that reverses
+	// it, declared with '-- +migrate Undo' right after the Up statement. It is
+	// nil when the migration declares no undo statements.
+	Undo map[int]string
+	// CompensateWithDown lets the Down statements undo Up statements without
+	// an Undo statement, matched in reverse order, declared with
+	// '-- +migrate CompensateWithDown' before the first section.
+	CompensateWithDown bool
+}
+
+// MatchesEnv reports whether something restricted to envs runs in env. No
+// restriction matches every environment. An empty env matches no
+// restriction, so restricted migrations are skipped when no environment is
+// configured.
+func MatchesEnv(envs []string, env string) bool {
+	if len(envs) == 0 {
+		return true
+	}
+	for _, e := range envs {
+		if e == env {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UpStatementsFor returns the Up statements to run in env, or nil when the
+// migration or its Up section is restricted to other environments.
+func (p *ParsedMigration) UpStatementsFor(env string) []string {
+	if !MatchesEnv(p.Envs, env) || !MatchesEnv(p.UpEnvs, env) {
+		return nil
+	}
+	return p.UpStatements
+}
+
+// DownStatementsFor returns the Down statements to run in env, or nil when
+// the migration or its Down section is restricted to other environments.
+func (p *ParsedMigration) DownStatementsFor(env string) []string {
+	if !MatchesEnv(p.Envs, env) || !MatchesEnv(p.DownEnvs, env) {
+		return nil
+	}
+	return p.DownStatements
 }
 
 // LineSeparator can be used to split migrations by an exact line match. This line
@@ -34,6 +95,10 @@ func errNoTerminator() error {
 			See https://github.com/blutspende/cassandra-migrate for details.`, LineSeparator)
 }
 
+func errUndoWithoutStatement() error {
+	return fmt.Errorf(`ERROR: '-- +migrate Undo' must be followed by a statement`)
+}
+
 // Checks the line to see if the line has a statement-ending semicolon
 // or if the line contains a double-dash comment.
 func endsWithSemicolon(line string) bool {
@@ -61,7 +126,8 @@ const (
 )
 
 type migrateCommand struct {
-	Command string
+	Command   string
+	Arguments []string
 }
 
 func parseCommand(line string) (*migrateCommand, error) {
@@ -77,10 +143,28 @@ func parseCommand(line string) (*migrateCommand, error) {
 	}
 
 	cmd.Command = fields[0]
+	cmd.Arguments = fields[1:]
 
 	return cmd, nil
 }
 
+// parseEnvs splits '-- +migrate Env' arguments on commas and whitespace.
+func parseEnvs(arguments []string) ([]string, error) {
+	envs := make([]string, 0, len(arguments))
+	for _, argument := range arguments {
+		for _, env := range strings.Split(argument, ",") {
+			if env = strings.TrimSpace(env); env != "" {
+				envs = append(envs, env)
+			}
+		}
+	}
+	if len(envs) == 0 {
+		return nil, fmt.Errorf(`ERROR: '-- +migrate Env' requires at least one environment`)
+	}
+
+	return envs, nil
+}
+
 // Split the given sql script into individual statements.
 //
 // The base case is to simply split on semicolons, as these
@@ -98,8 +182,13 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 
 	currentDirection := directionNone
+	sectionStarted := false
+	lineNumber := 0
+	statementLine := 0
+	undoPending := false
 
 	for scanner.Scan() {
+		lineNumber++
 		line := scanner.Text()
 		line = strings.TrimSpace(line)
 		// ignore comment except beginning with '-- +'
@@ -114,22 +203,74 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 				return nil, err
 			}
 
+			if undoPending {
+				return nil, errUndoWithoutStatement()
+			}
 			switch cmd.Command {
 			case "Up":
 				if len(strings.TrimSpace(buf.String())) > 0 {
 					return nil, errNoTerminator()
 				}
 				currentDirection = directionUp
+				sectionStarted = false
 
 			case "Down":
 				if len(strings.TrimSpace(buf.String())) > 0 {
 					return nil, errNoTerminator()
 				}
 				currentDirection = directionDown
+				sectionStarted = false
+
+			case "Env":
+				envs, err := parseEnvs(cmd.Arguments)
+				if err != nil {
+					return nil, err
+				}
+				switch {
+				case currentDirection == directionNone:
+					p.Envs = append(p.Envs, envs...)
+				case sectionStarted:
+					return nil, fmt.Errorf(`ERROR: '-- +migrate Env' must come before the first statement of a section`)
+				case currentDirection == directionUp:
+					p.UpEnvs = append(p.UpEnvs, envs...)
+				default:
+					p.DownEnvs = append(p.DownEnvs, envs...)
+				}
+
+			case "Dangerous":
+				if currentDirection != directionNone {
+					return nil, fmt.Errorf(`ERROR: '-- +migrate Dangerous' must come before the first section`)
+				}
+				p.Dangerous = true
+				p.DangerousReason = strings.Join(cmd.Arguments, " ")
+
+			case "CompensateWithDown":
+				if currentDirection != directionNone {
+					return nil, fmt.Errorf(`ERROR: '-- +migrate CompensateWithDown' must come before the first section`)
+				}
+				p.CompensateWithDown = true
+
+			case "Undo":
+				if len(strings.TrimSpace(buf.String())) > 0 {
+					return nil, errNoTerminator()
+				}
+				if currentDirection != directionUp || len(p.UpStatements) == 0 {
+					return nil, fmt.Errorf(`ERROR: '-- +migrate Undo' must follow a statement of the Up section`)
+				}
+				if _, ok := p.Undo[len(p.UpStatements)-1]; ok {
+					return nil, fmt.Errorf(`ERROR: '-- +migrate Undo' is declared twice for the same statement`)
+				}
+				undoPending = true
+
+			case "Covers":
+				if len(cmd.Arguments) == 0 {
+					return nil, fmt.Errorf(`ERROR: '-- +migrate Covers' requires at least one migration ID`)
+				}
+				p.Covers = append(p.Covers, cmd.Arguments...)
 
 			default:
 				return nil, fmt.Errorf(`ERROR: unsupported migration command %q.
-			Only '-- +migrate Up' and '-- +migrate Down' are supported.
+			Only '-- +migrate Up', '-- +migrate Down', '-- +migrate Undo', '-- +migrate CompensateWithDown', '-- +migrate Env', '-- +migrate Dangerous' and '-- +migrate Covers' are supported.
 			See https://github.com/blutspende/cassandra-migrate for details.`, cmd.Command)
 			}
 
@@ -141,6 +282,12 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 		}
 
 		isLineSeparator := len(LineSeparator) > 0 && line == LineSeparator
+		if line != "" && !strings.HasPrefix(line, "--") && !strings.HasPrefix(line, "//") {
+			sectionStarted = true
+		}
+		if statementLine == 0 && line != "" {
+			statementLine = lineNumber
+		}
 
 		if !isLineSeparator {
 			if _, err := buf.WriteString(line + "\n"); err != nil {
@@ -151,16 +298,27 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 		if endsWithSemicolon(line) || isLineSeparator {
 			switch currentDirection {
 			case directionUp:
+				if undoPending {
+					if p.Undo == nil {
+						p.Undo = make(map[int]string)
+					}
+					p.Undo[len(p.UpStatements)-1] = buf.String()
+					undoPending = false
+					break
+				}
 				p.UpStatements = append(p.UpStatements, buf.String())
+				p.UpLines = append(p.UpLines, statementLine)
 
 			case directionDown:
 				p.DownStatements = append(p.DownStatements, buf.String())
+				p.DownLines = append(p.DownLines, statementLine)
 
 			default:
 				panic("impossible state")
 			}
 
 			buf.Reset()
+			statementLine = 0
 		}
 	}
 
@@ -168,6 +326,10 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 		return nil, err
 	}
 
+	if undoPending {
+		return nil, errUndoWithoutStatement()
+	}
+
 	if currentDirection == directionNone {
 		return nil, fmt.Errorf(`ERROR: no Up/Down annotations found, so no statements were executed.
 			See https://github.com/blutspende/cassandra-migrate for details.`)
@@ -180,5 +342,10 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 		return nil, errNoTerminator()
 	}
 
+	if p.CompensateWithDown && len(p.UpStatements) != len(p.DownStatements) {
+		return nil, fmt.Errorf(`ERROR: '-- +migrate CompensateWithDown' needs as many Down statements as Up statements, found %d Up and %d Down statements`,
+			len(p.UpStatements), len(p.DownStatements))
+	}
+
 	return p, nil
 }
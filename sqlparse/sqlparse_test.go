@@ -42,6 +42,8 @@ DROP TABLE keyspace.post;
 
 	assert.Len(t, migration.UpStatements, 2)
 	assert.Len(t, migration.DownStatements, 2)
+	assert.Equal(t, []int{2, 6}, migration.UpLines)
+	assert.Equal(t, []int{9, 10}, migration.DownLines)
 }
 
 func TestParseMigration_SplitsStatementsByLineSeparator(t *testing.T) {
@@ -69,6 +71,115 @@ GO
 	assert.Len(t, migration.DownStatements, 2)
 }
 
+func TestParseMigration_Covers(t *testing.T) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Covers 0001-create-post.cql 0002-add-title.cql
+-- +migrate Covers 0003-add-index.cql
+-- +migrate Up
+CREATE TABLE keyspace.post (id int PRIMARY KEY, title text);
+
+-- +migrate Down
+DROP TABLE keyspace.post;
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"0001-create-post.cql", "0002-add-title.cql", "0003-add-index.cql"}, migration.Covers)
+	assert.Len(t, migration.UpStatements, 1)
+
+	_, err = ParseMigration(strings.NewReader("-- +migrate Covers\n-- +migrate Up\n"))
+	require.Error(t, err)
+}
+
+func TestParseMigration_Dangerous(t *testing.T) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Dangerous drops the legacy orders table
+-- +migrate Up
+DROP TABLE keyspace.orders;
+`))
+	require.NoError(t, err)
+
+	assert.True(t, migration.Dangerous)
+	assert.Equal(t, "drops the legacy orders table", migration.DangerousReason)
+
+	_, err = ParseMigration(strings.NewReader("-- +migrate Up\n-- +migrate Dangerous\nDROP TABLE keyspace.orders;\n"))
+	require.Error(t, err)
+}
+
+func TestParseMigration_CompensateWithDown(t *testing.T) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate CompensateWithDown
+-- +migrate Up
+CREATE TABLE keyspace.orders (id uuid PRIMARY KEY);
+ALTER TABLE keyspace.users ADD last_order uuid;
+-- +migrate Down
+ALTER TABLE keyspace.users DROP last_order;
+DROP TABLE keyspace.orders;
+`))
+	require.NoError(t, err)
+	assert.True(t, migration.CompensateWithDown)
+
+	_, err = ParseMigration(strings.NewReader("-- +migrate Up\n-- +migrate CompensateWithDown\nDROP TABLE keyspace.orders;\n"))
+	require.Error(t, err)
+
+	_, err = ParseMigration(strings.NewReader("-- +migrate CompensateWithDown\n-- +migrate Up\nCREATE TABLE keyspace.a (id int PRIMARY KEY);\nCREATE TABLE keyspace.b (id int PRIMARY KEY);\n-- +migrate Down\nDROP TABLE keyspace.b;\n"))
+	assert.EqualError(t, err, "ERROR: '-- +migrate CompensateWithDown' needs as many Down statements as Up statements, found 2 Up and 1 Down statements")
+}
+
+func TestParseMigration_Env(t *testing.T) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Env development, test
+-- +migrate Up
+-- seed reference data
+-- +migrate Env development
+INSERT INTO keyspace.country (code) VALUES ('DE');
+
+-- +migrate Down
+DELETE FROM keyspace.country WHERE code = 'DE';
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"development", "test"}, migration.Envs)
+	assert.Equal(t, []string{"development"}, migration.UpEnvs)
+	assert.Empty(t, migration.DownEnvs)
+	assert.Len(t, migration.UpStatementsFor("development"), 1)
+	assert.Nil(t, migration.UpStatementsFor("test"))
+	assert.Len(t, migration.DownStatementsFor("test"), 1)
+	assert.Nil(t, migration.DownStatementsFor("production"))
+	assert.Nil(t, migration.UpStatementsFor(""))
+	assert.Nil(t, migration.DownStatementsFor(""))
+}
+
+func TestParseMigration_EnvAfterComments(t *testing.T) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Up
+--
+--note without a space
+// seed reference data
+-- +migrate Env development
+INSERT INTO keyspace.country (code) VALUES ('DE');
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"development"}, migration.UpEnvs)
+	assert.Len(t, migration.UpStatementsFor("development"), 1)
+}
+
+func TestParseMigration_RejectsMisplacedEnv(t *testing.T) {
+	_, err := ParseMigration(strings.NewReader(`-- +migrate Up
+CREATE TABLE keyspace.post (id int PRIMARY KEY);
+-- +migrate Env development
+`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must come before the first statement of a section")
+
+	_, err = ParseMigration(strings.NewReader("-- +migrate Env ,\n-- +migrate Up\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "requires at least one environment")
+}
+
+func TestMatchesEnv(t *testing.T) {
+	assert.True(t, MatchesEnv(nil, "production"))
+	assert.True(t, MatchesEnv([]string{"development", "test"}, "test"))
+	assert.False(t, MatchesEnv([]string{"development", "test"}, "production"))
+	assert.True(t, MatchesEnv(nil, ""))
+	assert.False(t, MatchesEnv([]string{"development", "test"}, ""))
+}
+
 func TestParseMigration_RejectsUnsupportedCommand(t *testing.T) {
 	_, err := ParseMigration(strings.NewReader(`-- +migrate Up
 CREATE TABLE keyspace.post (id int PRIMARY KEY);
@@ -119,3 +230,36 @@ DROP TABLE IF EXISTS keyspace.users;
 	assert.Len(t, migration.UpStatements, 1)
 	assert.Len(t, migration.DownStatements, 1)
 }
+
+func TestParseMigration_Undo(t *testing.T) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Up
+CREATE TABLE keyspace.post (id int PRIMARY KEY);
+-- +migrate Undo
+DROP TABLE keyspace.post;
+ALTER TABLE keyspace.user ADD bio text;
+CREATE INDEX post_by_title ON keyspace.post (title);
+-- +migrate Undo
+DROP INDEX keyspace.post_by_title;
+
+-- +migrate Down
+DROP TABLE keyspace.post;
+`))
+	require.NoError(t, err)
+
+	assert.Len(t, migration.UpStatements, 3)
+	assert.Equal(t, []int{2, 5, 6}, migration.UpLines)
+	assert.Equal(t, map[int]string{
+		0: "DROP TABLE keyspace.post;\n",
+		2: "DROP INDEX keyspace.post_by_title;\n",
+	}, migration.Undo)
+
+	for _, content := range []string{
+		"-- +migrate Up\n-- +migrate Undo\nDROP TABLE keyspace.post;\n",
+		"-- +migrate Up\nCREATE TABLE keyspace.post (id int PRIMARY KEY);\n-- +migrate Undo\n",
+		"-- +migrate Up\nCREATE TABLE keyspace.post (id int PRIMARY KEY);\n-- +migrate Undo\n-- +migrate Down\n",
+		"-- +migrate Up\nSELECT 1;\n-- +migrate Down\nSELECT 1;\n-- +migrate Undo\nSELECT 2;\n",
+	} {
+		_, err = ParseMigration(strings.NewReader(content))
+		assert.Error(t, err, content)
+	}
+}
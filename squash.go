@@ -0,0 +1,261 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blutspende/cassandra-migrate/schema"
+	"github.com/blutspende/cassandra-migrate/sqlparse"
+)
+
+const (
+	// SquashArchiveDir is the directory below MigrationDir that squashed
+	// migration files are moved to.
+	SquashArchiveDir = "archive"
+
+	baselineSuffix = "-baseline.cql"
+)
+
+// SquashResult describes the baseline written by Squash.
+type SquashResult struct {
+	BaselineID   string
+	BaselinePath string
+	// Covers holds the replaced migration IDs in version order.
+	Covers     []string
+	ArchiveDir string
+}
+
+// Squash replaces all migrations up to and including through with a single
+// baseline migration. The baseline creates the schema that results from the
+// replaced migrations and its Down section drops that schema again. The
+// replaced files are moved to SquashArchiveDir and the baseline is recorded
+// as applied, so the tracking table covers the old IDs through the baseline.
+// Every replaced migration must be applied in the configured environment.
+func Squash(conf Config, through string) (SquashResult, error) {
+	return SquashContext(context.Background(), conf, through)
+}
+
+// SquashContext is Squash with a context for query cancellation.
+func SquashContext(ctx context.Context, conf Config, through string) (SquashResult, error) {
+	migrationFiles, err := listMigrationFiles(conf)
+	if err != nil {
+		return SquashResult{}, err
+	}
+	index := slices.IndexFunc(migrationFiles, func(file string) bool {
+		return filepath.Base(file) == through
+	})
+	if index < 0 {
+		return SquashResult{}, fmt.Errorf("migration file %s not found in %s", through, conf.MigrationDir)
+	}
+	squashedFiles := migrationFiles[:index+1]
+
+	session, err := openSession(conf)
+	if err != nil {
+		return SquashResult{}, err
+	}
+	defer session.Close()
+	err = session.Exec(ctx, fmt.Sprintf(createMigrationsTableQueryTemplate, conf.TrackingTable()))
+	if err != nil {
+		return SquashResult{}, err
+	}
+	history, err := newHistoryRecorder(conf, func(statement string, args ...any) error {
+		return session.Exec(ctx, statement, args...)
+	})
+	if err != nil {
+		return SquashResult{}, err
+	}
+	existingMigrationIDs, err := existingMigrationIDs(ctx, session, conf.TrackingTable())
+	if err != nil {
+		return SquashResult{}, err
+	}
+	for _, file := range squashedFiles {
+		if _, ok := existingMigrationIDs[filepath.Base(file)]; !ok {
+			return SquashResult{}, fmt.Errorf("migration %s is not applied, apply it before squashing", filepath.Base(file))
+		}
+	}
+
+	content, covers, err := buildBaseline(conf.Keyspace, squashedFiles, through)
+	if err != nil {
+		return SquashResult{}, err
+	}
+	version, _, _ := strings.Cut(through, "-")
+	result := SquashResult{
+		BaselineID:   version + baselineSuffix,
+		BaselinePath: filepath.Join(conf.MigrationDir, version+baselineSuffix),
+		Covers:       covers,
+		ArchiveDir:   filepath.Join(conf.MigrationDir, SquashArchiveDir),
+	}
+	if err := archiveMigrations(squashedFiles, result.ArchiveDir); err != nil {
+		return SquashResult{}, err
+	}
+	if err := os.WriteFile(result.BaselinePath, content, 0o666); err != nil {
+		return SquashResult{}, err
+	}
+	conf.logger().Info("squashed migrations", "baseline", result.BaselineID, "covers", len(covers))
+
+	// ApplyUp records the baseline as well when this fails, as all covered
+	// migrations are applied
+	err = recordBaseline(ctx, conf, session, result.BaselineID, covers)
+	history.record(result.BaselineID, HistoryBaseline, checksum(content), 0, err)
+	if err != nil {
+		return result, fmt.Errorf("failed to record baseline %s: %w", result.BaselineID, err)
+	}
+
+	return result, nil
+}
+
+// buildBaseline renders the baseline migration for files and returns it with
+// the covered IDs. The Up section creates the schema that results from the
+// Up sections of files in keyspace, the Down section drops exactly those
+// objects. Files with data, role or permission statements are refused, as
+// the baseline cannot carry them over. Covered IDs of earlier baselines are
+// carried over.
+func buildBaseline(keyspace string, files []string, through string) ([]byte, []string, error) {
+	covers := make([]string, 0, len(files))
+	result := schema.New(keyspace)
+	for _, file := range files {
+		id := filepath.Base(file)
+		migration, err := parseMigrationFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(migration.Envs) > 0 || len(migration.UpEnvs) > 0 || len(migration.DownEnvs) > 0 {
+			return nil, nil, fmt.Errorf("cannot squash %s: it is restricted to environments", id)
+		}
+		for i, statement := range migration.UpStatements {
+			if !schema.IsSchemaStatement(statement) {
+				return nil, nil, fmt.Errorf("cannot squash %s:%d: only schema statements are carried over to the baseline, move data, role and permission statements to a later migration: %s",
+					id, migration.UpLines[i], strings.TrimSpace(statement))
+			}
+		}
+		if failed := simulateStatements(result, id, DirectionUp, migration.UpStatements, migration.UpLines); len(failed) > 0 {
+			return nil, nil, fmt.Errorf("cannot squash: %w", failed[0])
+		}
+		covers = append(covers, migration.Covers...)
+		covers = append(covers, id)
+	}
+
+	objects := result.Objects()
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "-- Baseline of %d migrations through %s, created by squash.\n", len(covers), through)
+	for _, id := range covers {
+		fmt.Fprintf(&content, "-- +migrate Covers %s\n", id)
+	}
+	content.WriteString("\n-- +migrate Up\n")
+	for _, object := range objects {
+		content.WriteString(object.CQL + "\n")
+	}
+	content.WriteString("-- +migrate Down\n")
+	for i := len(objects) - 1; i >= 0; i-- {
+		content.WriteString(objects[i].Drop() + "\n")
+	}
+
+	return content.Bytes(), covers, nil
+}
+
+// recordBaseline records baselineID as applied at the applied_at of the
+// newest covered migration, so ApplyDown still reverts the migrations applied
+// after it first instead of the baseline.
+func recordBaseline(ctx context.Context, conf Config, session Session, baselineID string, covers []string) error {
+	applied, err := existingMigrations(ctx, session, conf.TrackingTable())
+	if err != nil {
+		return err
+	}
+	var appliedAt time.Time
+	for _, migration := range applied {
+		if slices.Contains(covers, migration.ID) && migration.AppliedAt.After(appliedAt) {
+			appliedAt = migration.AppliedAt
+		}
+	}
+	if appliedAt.IsZero() {
+		appliedAt = time.Now()
+	}
+
+	return session.Exec(ctx, fmt.Sprintf(insertMigrationAtQueryTemplate, conf.TrackingTable()), baselineID, appliedAt)
+}
+
+// archiveMigrations moves files to archiveDir, refusing to overwrite archived files.
+func archiveMigrations(files []string, archiveDir string) error {
+	if err := os.MkdirAll(archiveDir, 0o755); err != nil {
+		return err
+	}
+	for _, file := range files {
+		target := filepath.Join(archiveDir, filepath.Base(file))
+		if _, err := os.Stat(target); !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("archived migration %s already exists", target)
+		}
+	}
+	for _, file := range files {
+		if err := os.Rename(file, filepath.Join(archiveDir, filepath.Base(file))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readBaselines returns the covered IDs of every baseline in files, keyed by
+// the baseline ID.
+func readBaselines(files []string) (map[string][]string, error) {
+	baselines := make(map[string][]string)
+	for _, file := range files {
+		id := filepath.Base(file)
+		if !strings.HasSuffix(id, baselineSuffix) {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		migration, err := sqlparse.ParseMigration(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", id, err)
+		}
+		baselines[id] = migration.Covers
+	}
+
+	return baselines, nil
+}
+
+// adoptableBaselines returns the pending baselines whose covered migrations
+// are all applied. ApplyUp records those without running their statements.
+// A baseline whose covered migrations are only partly applied is an error,
+// as neither running nor skipping it yields the expected schema.
+func adoptableBaselines(baselines map[string][]string, existingMigrationIDs map[string]any) ([]string, error) {
+	adoptable := make([]string, 0)
+	for id, covers := range baselines {
+		if _, ok := existingMigrationIDs[id]; ok || len(covers) == 0 {
+			continue
+		}
+		// an applied earlier baseline covers every ID listed before it
+		first := 0
+		for i, covered := range covers {
+			if _, ok := existingMigrationIDs[covered]; ok && strings.HasSuffix(covered, baselineSuffix) {
+				first = i + 1
+			}
+		}
+		missing := make([]string, 0)
+		for _, covered := range covers[first:] {
+			if _, ok := existingMigrationIDs[covered]; !ok {
+				missing = append(missing, covered)
+			}
+		}
+		switch {
+		case len(missing) == 0:
+			adoptable = append(adoptable, id)
+		case first == 0 && len(missing) == len(covers):
+		default:
+			return nil, fmt.Errorf("baseline %s covers migrations that are only partly applied, missing: %s", id, strings.Join(missing, ", "))
+		}
+	}
+	slices.SortFunc(adoptable, CompareMigrationIDs)
+
+	return adoptable, nil
+}
@@ -0,0 +1,209 @@
+package migrate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blutspende/cassandra-migrate/sqlparse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeMigrationFile(t *testing.T, dir, id, content string) string {
+	t.Helper()
+	file := filepath.Join(dir, id)
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+	return file
+}
+
+func TestBuildBaseline(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{
+		writeMigrationFile(t, tempDir, "0001-create-users.cql", `-- +migrate Up
+CREATE TABLE users (id uuid PRIMARY KEY);
+-- +migrate Down
+DROP TABLE users;
+`),
+		writeMigrationFile(t, tempDir, "0002-add-email.cql", `-- +migrate Up
+ALTER TABLE users ADD email text;
+CREATE INDEX users_email_idx ON users (email);
+-- +migrate Down
+DROP INDEX users_email_idx;
+ALTER TABLE users DROP email;
+`),
+	}
+
+	content, covers, err := buildBaseline("bloodlab", files, "0002-add-email.cql")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0001-create-users.cql", "0002-add-email.cql"}, covers)
+
+	migration, err := sqlparse.ParseMigration(bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, covers, migration.Covers)
+	assert.Equal(t, []string{
+		"CREATE TABLE bloodlab.users (\nid uuid,\nemail text,\nPRIMARY KEY (id)\n);\n",
+		"CREATE INDEX users_email_idx ON bloodlab.users (email);\n",
+	}, migration.UpStatements)
+	assert.Equal(t, []string{
+		"DROP INDEX bloodlab.users_email_idx;\n",
+		"DROP TABLE bloodlab.users;\n",
+	}, migration.DownStatements)
+}
+
+func TestBuildBaseline_FinalSchemaOnly(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{
+		writeMigrationFile(t, tempDir, "0001-create-users.cql", `-- +migrate Up
+CREATE TABLE users (id uuid PRIMARY KEY, legacy text);
+CREATE TABLE audit (id uuid PRIMARY KEY);
+-- +migrate Down
+DROP TABLE audit;
+DROP TABLE users;
+`),
+		writeMigrationFile(t, tempDir, "0002-cleanup.cql", `-- +migrate Up
+ALTER TABLE users DROP legacy;
+DROP TABLE audit;
+-- +migrate Down
+CREATE TABLE audit (id uuid PRIMARY KEY);
+ALTER TABLE users ADD legacy text;
+`),
+	}
+
+	content, _, err := buildBaseline("bloodlab", files, "0002-cleanup.cql")
+	require.NoError(t, err)
+
+	migration, err := sqlparse.ParseMigration(bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CREATE TABLE bloodlab.users (\nid uuid,\nPRIMARY KEY (id)\n);\n"}, migration.UpStatements)
+	assert.Equal(t, []string{"DROP TABLE bloodlab.users;\n"}, migration.DownStatements)
+}
+
+func TestBuildBaseline_RefusesDataStatements(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{
+		writeMigrationFile(t, tempDir, "0001-create-users.cql", "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\nINSERT INTO users (id) VALUES (uuid());\n"),
+	}
+
+	_, _, err := buildBaseline("bloodlab", files, "0001-create-users.cql")
+	require.Error(t, err)
+	assert.Equal(t, "cannot squash 0001-create-users.cql:3: only schema statements are carried over to the baseline, move data, role and permission statements to a later migration: INSERT INTO users (id) VALUES (uuid());", err.Error())
+
+	files = []string{
+		writeMigrationFile(t, tempDir, "0002-grant.cql", "-- +migrate Up\nGRANT SELECT ON KEYSPACE bloodlab TO reader;\n"),
+	}
+	_, _, err = buildBaseline("bloodlab", files, "0002-grant.cql")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot squash 0002-grant.cql:2")
+}
+
+func TestBuildBaseline_RefusesFailingStatement(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{
+		writeMigrationFile(t, tempDir, "0001-add-email.cql", "-- +migrate Up\nALTER TABLE users ADD email text;\n"),
+	}
+
+	_, _, err := buildBaseline("bloodlab", files, "0001-add-email.cql")
+	require.Error(t, err)
+	var simulationErr *SimulationError
+	require.ErrorAs(t, err, &simulationErr)
+	assert.Equal(t, "0001-add-email.cql", simulationErr.MigrationID)
+	assert.Equal(t, 2, simulationErr.Line)
+}
+
+func TestBuildBaseline_CarriesOverEarlierBaseline(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{
+		writeMigrationFile(t, tempDir, "0002-baseline.cql", `-- +migrate Covers 0001-create-users.cql 0002-add-email.cql
+-- +migrate Up
+CREATE TABLE users (id uuid PRIMARY KEY, email text);
+-- +migrate Down
+DROP TABLE users;
+`),
+		writeMigrationFile(t, tempDir, "0003-create-orders.cql", `-- +migrate Up
+CREATE TABLE orders (id uuid PRIMARY KEY);
+-- +migrate Down
+DROP TABLE orders;
+`),
+	}
+
+	_, covers, err := buildBaseline("bloodlab", files, "0003-create-orders.cql")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0001-create-users.cql", "0002-add-email.cql", "0002-baseline.cql", "0003-create-orders.cql"}, covers)
+}
+
+func TestBuildBaseline_RefusesEnvironmentRestrictedMigration(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{
+		writeMigrationFile(t, tempDir, "0001-seed-users.cql", "-- +migrate Up\n-- +migrate Env development\nINSERT INTO users (id) VALUES (uuid());\n"),
+	}
+
+	_, _, err := buildBaseline("bloodlab", files, "0001-seed-users.cql")
+	assert.EqualError(t, err, "cannot squash 0001-seed-users.cql: it is restricted to environments")
+}
+
+func TestArchiveMigrations(t *testing.T) {
+	tempDir := t.TempDir()
+	file := writeMigrationFile(t, tempDir, "0001-create-users.cql", "")
+	archiveDir := filepath.Join(tempDir, SquashArchiveDir)
+
+	require.NoError(t, archiveMigrations([]string{file}, archiveDir))
+	assert.NoFileExists(t, file)
+	assert.FileExists(t, filepath.Join(archiveDir, "0001-create-users.cql"))
+
+	file = writeMigrationFile(t, tempDir, "0001-create-users.cql", "")
+	err := archiveMigrations([]string{file}, archiveDir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+	assert.FileExists(t, file)
+}
+
+func TestReadBaselines(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{
+		writeMigrationFile(t, tempDir, "0002-baseline.cql", "-- +migrate Covers 0001-create-users.cql 0002-add-email.cql\n-- +migrate Up\n"),
+		writeMigrationFile(t, tempDir, "0003-create-orders.cql", "not parsed"),
+	}
+
+	baselines, err := readBaselines(files)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"0002-baseline.cql": {"0001-create-users.cql", "0002-add-email.cql"}}, baselines)
+}
+
+func TestAdoptableBaselines(t *testing.T) {
+	baselines := map[string][]string{"0002-baseline.cql": {"0001-create-users.cql", "0002-add-email.cql"}}
+
+	adoptable, err := adoptableBaselines(baselines, map[string]any{"0001-create-users.cql": nil, "0002-add-email.cql": nil})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0002-baseline.cql"}, adoptable)
+
+	adoptable, err = adoptableBaselines(baselines, map[string]any{})
+	require.NoError(t, err)
+	assert.Empty(t, adoptable)
+
+	adoptable, err = adoptableBaselines(baselines, map[string]any{"0002-baseline.cql": nil})
+	require.NoError(t, err)
+	assert.Empty(t, adoptable)
+
+	nested := map[string][]string{"0003-baseline.cql": {"0001-create-users.cql", "0002-add-email.cql", "0002-baseline.cql", "0003-create-orders.cql"}}
+	adoptable, err = adoptableBaselines(nested, map[string]any{"0002-baseline.cql": nil, "0003-create-orders.cql": nil})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0003-baseline.cql"}, adoptable)
+
+	_, err = adoptableBaselines(nested, map[string]any{"0002-baseline.cql": nil})
+	require.Error(t, err)
+
+	_, err = adoptableBaselines(baselines, map[string]any{"0001-create-users.cql": nil})
+	require.Error(t, err)
+	assert.Equal(t, "baseline 0002-baseline.cql covers migrations that are only partly applied, missing: 0002-add-email.cql", err.Error())
+}
+
+func TestSquash_UnknownMigration(t *testing.T) {
+	tempDir := t.TempDir()
+	writeMigrationFile(t, tempDir, "0001-create-users.cql", "")
+
+	_, err := Squash(Config{MigrationDir: tempDir}, "0002-add-email.cql")
+	require.Error(t, err)
+	assert.Equal(t, "migration file 0002-add-email.cql not found in "+tempDir, err.Error())
+}
@@ -0,0 +1,182 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/blutspende/cassandra-migrate/sqlparse"
+)
+
+const (
+	// OutOfOrderAllow applies out of order migrations and only logs them.
+	OutOfOrderAllow = "allow"
+	// OutOfOrderWarn applies out of order migrations and logs a warning.
+	OutOfOrderWarn = "warn"
+	// OutOfOrderFail refuses to apply anything while out of order migrations are pending.
+	OutOfOrderFail = "fail"
+
+	DefaultOutOfOrderPolicy = OutOfOrderWarn
+)
+
+// ErrOutOfOrderMigrations is returned by ApplyUp when the out of order policy
+// is OutOfOrderFail and pending migrations are older than the newest applied one.
+var ErrOutOfOrderMigrations = errors.New("out of order migrations pending")
+
+// Status describes the applied and pending migrations of a keyspace.
+type Status struct {
+	// Applied holds the applied migrations in version order.
+	Applied []Migration
+	// Pending holds the IDs of migration files that are not applied, in the
+	// order ApplyUp would apply them.
+	Pending []string
+	// OutOfOrder holds the pending IDs whose version sorts before the newest applied ID.
+	OutOfOrder []string
+	// PendingRepeatable holds the repeatable migrations that are new or changed.
+	PendingRepeatable []string
+	// Skipped holds the migration files whose Up statements are restricted to
+	// other environments. ApplyUp records them without running those statements.
+	Skipped []string
+}
+
+// GetStatus returns the applied and pending migrations. It only reads, so it
+// works with read-only roles: missing tracking tables count as empty.
+func GetStatus(conf Config) (Status, error) {
+	return GetStatusContext(context.Background(), conf)
+}
+
+// GetStatusContext is GetStatus with a context for query cancellation.
+func GetStatusContext(ctx context.Context, conf Config) (Status, error) {
+	migrationFiles, err := listMigrationFiles(conf)
+	if err != nil {
+		return Status{}, err
+	}
+	session, err := openSession(conf)
+	if err != nil {
+		return Status{}, err
+	}
+	defer session.Close()
+	repeatables, err := loadPendingRepeatables(ctx, conf, session, nil)
+	if err != nil {
+		return Status{}, err
+	}
+	pendingRepeatable := make([]string, 0, len(repeatables))
+	for _, repeatable := range repeatables {
+		pendingRepeatable = append(pendingRepeatable, repeatable.id)
+	}
+	applied, err := existingMigrations(ctx, session, conf.TrackingTable())
+	if isMissingTableError(err) {
+		applied, err = []Migration{}, nil
+	}
+	if err != nil {
+		return Status{}, err
+	}
+	slices.SortFunc(applied, func(left, right Migration) int {
+		return CompareMigrationIDs(left.ID, right.ID)
+	})
+	appliedIDs := make(map[string]any, len(applied))
+	for _, migration := range applied {
+		appliedIDs[migration.ID] = nil
+	}
+	pending := make([]string, 0)
+	for _, file := range migrationFiles {
+		if _, ok := appliedIDs[filepath.Base(file)]; !ok {
+			pending = append(pending, filepath.Base(file))
+		}
+	}
+	skipped, err := skippedMigrationIDs(migrationFiles, conf.Environment)
+	if err != nil {
+		return Status{}, err
+	}
+
+	return Status{
+		Applied:           applied,
+		Pending:           pending,
+		OutOfOrder:        outOfOrderMigrationIDs(appliedIDs, pending),
+		PendingRepeatable: pendingRepeatable,
+		Skipped:           skipped,
+	}, nil
+}
+
+// skippedMigrationIDs returns the IDs of files whose Up statements do not run in env.
+func skippedMigrationIDs(files []string, env string) ([]string, error) {
+	skipped := make([]string, 0)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		migration, err := sqlparse.ParseMigration(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		if skipsUp(migration, env) {
+			skipped = append(skipped, filepath.Base(file))
+		}
+	}
+
+	return skipped, nil
+}
+
+// outOfOrderMigrationIDs returns the pending IDs whose version sorts before
+// the newest applied ID.
+func outOfOrderMigrationIDs(appliedIDs map[string]any, pendingIDs []string) []string {
+	newest := ""
+	for id := range appliedIDs {
+		if newest == "" || CompareMigrationIDs(id, newest) > 0 {
+			newest = id
+		}
+	}
+	outOfOrder := make([]string, 0)
+	for _, id := range pendingIDs {
+		if newest != "" && CompareMigrationIDs(id, newest) < 0 {
+			outOfOrder = append(outOfOrder, id)
+		}
+	}
+
+	return outOfOrder
+}
+
+// checkOutOfOrder reports the out of order migrations to conf.OutOfOrderFound,
+// logs them according to conf.OutOfOrder and returns ErrOutOfOrderMigrations
+// for OutOfOrderFail.
+func checkOutOfOrder(conf Config, outOfOrder []string) error {
+	if len(outOfOrder) == 0 {
+		return nil
+	}
+	if conf.OutOfOrderFound != nil {
+		conf.OutOfOrderFound(outOfOrder)
+	}
+	logger := conf.logger()
+	switch conf.OutOfOrder {
+	case OutOfOrderFail:
+		for _, id := range outOfOrder {
+			logger.Error("out of order migration", "migration", id)
+		}
+		return fmt.Errorf("%w: %s", ErrOutOfOrderMigrations, strings.Join(outOfOrder, ", "))
+	case OutOfOrderAllow:
+		for _, id := range outOfOrder {
+			logger.Info("out of order migration", "migration", id)
+		}
+	default:
+		for _, id := range outOfOrder {
+			logger.Warn("out of order migration", "migration", id)
+		}
+	}
+
+	return nil
+}
+
+func validateOutOfOrderPolicy(policy string) error {
+	switch policy {
+	case OutOfOrderAllow, OutOfOrderWarn, OutOfOrderFail:
+		return nil
+	default:
+		return fmt.Errorf("invalid out_of_order %q: must be allow, warn or fail", policy)
+	}
+}
@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutOfOrderMigrationIDs(t *testing.T) {
+	applied := map[string]any{
+		"20260401000000-create-users.cql": nil,
+		"20260410000000-add-email.cql":    nil,
+	}
+	pending := []string{
+		"20260405000000-feature-branch.cql",
+		"20260420000000-add-index.cql",
+	}
+
+	assert.Equal(t, []string{"20260405000000-feature-branch.cql"}, outOfOrderMigrationIDs(applied, pending))
+	assert.Empty(t, outOfOrderMigrationIDs(map[string]any{}, pending))
+}
+
+func TestCheckOutOfOrder(t *testing.T) {
+	outOfOrder := []string{"20260405000000-feature-branch.cql"}
+	tests := []struct {
+		policy string
+		level  string
+		fails  bool
+	}{
+		{policy: OutOfOrderAllow, level: "INFO"},
+		{policy: OutOfOrderWarn, level: "WARN"},
+		{policy: OutOfOrderFail, level: "ERROR", fails: true},
+	}
+
+	for _, test := range tests {
+		var logs bytes.Buffer
+		var found []string
+		conf := Config{
+			OutOfOrder:      test.policy,
+			Logger:          slog.New(slog.NewTextHandler(&logs, nil)),
+			OutOfOrderFound: func(migrationIDs []string) { found = migrationIDs },
+		}
+		err := checkOutOfOrder(conf, outOfOrder)
+		assert.Equal(t, outOfOrder, found, test.policy)
+		if test.fails {
+			require.ErrorIs(t, err, ErrOutOfOrderMigrations, test.policy)
+			assert.Equal(t, "out of order migrations pending: 20260405000000-feature-branch.cql", err.Error())
+		} else {
+			require.NoError(t, err, test.policy)
+		}
+		assert.Contains(t, logs.String(), "level="+test.level, test.policy)
+		assert.Contains(t, logs.String(), "migration=20260405000000-feature-branch.cql", test.policy)
+	}
+
+	assert.NoError(t, checkOutOfOrder(Config{OutOfOrder: OutOfOrderFail}, nil))
+}
+
+func TestSkippedMigrationIDs(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{
+		writeMigrationFile(t, tempDir, "0001-create-users.cql", "-- +migrate Up\nCREATE TABLE users (id uuid PRIMARY KEY);\n"),
+		writeMigrationFile(t, tempDir, "0002-seed-users.cql", "-- +migrate Env development,test\n-- +migrate Up\nINSERT INTO users (id) VALUES (uuid());\n"),
+		writeMigrationFile(t, tempDir, "0003-drop-seed.cql", "-- +migrate Up\n-- +migrate Env production\nTRUNCATE users;\n"),
+	}
+
+	skipped, err := skippedMigrationIDs(files, "production")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0002-seed-users.cql"}, skipped)
+
+	skipped, err = skippedMigrationIDs(files, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0003-drop-seed.cql"}, skipped)
+
+	skipped, err = skippedMigrationIDs(files, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0002-seed-users.cql", "0003-drop-seed.cql"}, skipped)
+}
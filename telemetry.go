@@ -0,0 +1,115 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+const instrumentationName = "github.com/blutspende/cassandra-migrate"
+
+// tracer returns the tracer of conf.TracerProvider, or a no-op tracer.
+func (c Config) tracer() trace.Tracer {
+	if c.TracerProvider == nil {
+		return tracenoop.NewTracerProvider().Tracer(instrumentationName)
+	}
+	return c.TracerProvider.Tracer(instrumentationName)
+}
+
+// migrationMetrics holds the instruments recorded for each migration.
+type migrationMetrics struct {
+	applied  metric.Int64Counter
+	failed   metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+// newMigrationMetrics creates the instruments from conf.MeterProvider, or
+// no-op instruments when none is configured.
+func newMigrationMetrics(conf Config) (migrationMetrics, error) {
+	provider := conf.MeterProvider
+	if provider == nil {
+		provider = metricnoop.NewMeterProvider()
+	}
+	meter := provider.Meter(instrumentationName)
+
+	applied, err := meter.Int64Counter(
+		"cassandra_migrate.migrations.applied",
+		metric.WithDescription("Number of migrations applied or reverted"),
+	)
+	if err != nil {
+		return migrationMetrics{}, err
+	}
+	failed, err := meter.Int64Counter(
+		"cassandra_migrate.migrations.failed",
+		metric.WithDescription("Number of migrations that failed"),
+	)
+	if err != nil {
+		return migrationMetrics{}, err
+	}
+	duration, err := meter.Float64Histogram(
+		"cassandra_migrate.migration.duration",
+		metric.WithDescription("Duration of a single migration"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return migrationMetrics{}, err
+	}
+
+	return migrationMetrics{applied: applied, failed: failed, duration: duration}, nil
+}
+
+// record adds one migration outcome to the instruments.
+func (m migrationMetrics) record(ctx context.Context, keyspace string, direction Direction, duration time.Duration, err error) {
+	attrs := metric.WithAttributes(
+		attribute.String("cassandra_migrate.keyspace", keyspace),
+		attribute.String("cassandra_migrate.direction", string(direction)),
+	)
+	m.duration.Record(ctx, duration.Seconds(), attrs)
+	if err != nil {
+		m.failed.Add(ctx, 1, attrs)
+		return
+	}
+	m.applied.Add(ctx, 1, attrs)
+}
+
+// startRunSpan starts the span covering one ApplyUp or ApplyDown call.
+func startRunSpan(ctx context.Context, conf Config, direction Direction) (context.Context, trace.Span) {
+	return conf.tracer().Start(ctx, "cassandra_migrate.run", trace.WithAttributes(
+		attribute.String("cassandra_migrate.keyspace", conf.Keyspace),
+		attribute.String("cassandra_migrate.environment", conf.Environment),
+		attribute.String("cassandra_migrate.direction", string(direction)),
+	))
+}
+
+// startMigrationSpan starts the span covering one migration file.
+func startMigrationSpan(ctx context.Context, conf Config, migrationID string, direction Direction) (context.Context, trace.Span) {
+	return conf.tracer().Start(ctx, "cassandra_migrate.migration", trace.WithAttributes(
+		attribute.String("cassandra_migrate.migration", migrationID),
+		attribute.String("cassandra_migrate.direction", string(direction)),
+	))
+}
+
+// startStatementSpan starts the span covering one CQL statement.
+func startStatementSpan(ctx context.Context, conf Config, migrationID string, index int, statement string) (context.Context, trace.Span) {
+	return conf.tracer().Start(ctx, "cassandra_migrate.statement", trace.WithAttributes(
+		attribute.String("cassandra_migrate.migration", migrationID),
+		attribute.Int("cassandra_migrate.statement_index", index),
+		attribute.String("db.system", "cassandra"),
+		attribute.String("db.statement", statement),
+	))
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
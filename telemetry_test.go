@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestApplyAndRecordMigration_StatementSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	conf := Config{Keyspace: "bloodlab", TracerProvider: provider}
+
+	ctx, migrationSpan := startMigrationSpan(context.Background(), conf, "20260422123000-create-users.cql", DirectionUp)
+	expectedErr := errors.New("statement failed")
+	err := applyAndRecordMigration(
+		ctx,
+		conf,
+		filepath.Join("migrations", "20260422123000-create-users.cql"),
+		[]string{
+			"CREATE TABLE users (id uuid PRIMARY KEY);",
+			"CREATE INDEX users_id_idx ON users (id);",
+		},
+		func(statement string, args ...any) error {
+			if statement == "CREATE INDEX users_id_idx ON users (id);" {
+				return expectedErr
+			}
+			return nil
+		},
+	)
+	endSpan(migrationSpan, err)
+	require.Error(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "cassandra_migrate.statement", spans[0].Name)
+	assert.Contains(t, spans[0].Attributes, attribute.Int("cassandra_migrate.statement_index", 0))
+	assert.Contains(t, spans[0].Attributes, attribute.String("db.statement", "CREATE TABLE users (id uuid PRIMARY KEY);"))
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Equal(t, "cassandra_migrate.statement", spans[1].Name)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, "cassandra_migrate.migration", spans[2].Name)
+	assert.Equal(t, codes.Error, spans[2].Status.Code)
+	assert.Contains(t, spans[2].Attributes, attribute.String("cassandra_migrate.migration", "20260422123000-create-users.cql"))
+	assert.Equal(t, spans[2].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, spans[2].SpanContext.SpanID(), spans[1].Parent.SpanID())
+}
+
+func TestMigrationMetrics_Record(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	conf := Config{MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))}
+	metrics, err := newMigrationMetrics(conf)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	metrics.record(ctx, "bloodlab", DirectionUp, 2*time.Second, nil)
+	metrics.record(ctx, "bloodlab", DirectionUp, time.Second, nil)
+	metrics.record(ctx, "bloodlab", DirectionUp, time.Second, errors.New("failed"))
+
+	var data metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &data))
+	require.Len(t, data.ScopeMetrics, 1)
+	values := make(map[string]metricdata.Aggregation)
+	for _, m := range data.ScopeMetrics[0].Metrics {
+		values[m.Name] = m.Data
+	}
+
+	applied := values["cassandra_migrate.migrations.applied"].(metricdata.Sum[int64])
+	require.Len(t, applied.DataPoints, 1)
+	assert.Equal(t, int64(2), applied.DataPoints[0].Value)
+	direction, ok := applied.DataPoints[0].Attributes.Value("cassandra_migrate.direction")
+	require.True(t, ok)
+	assert.Equal(t, "up", direction.AsString())
+
+	failed := values["cassandra_migrate.migrations.failed"].(metricdata.Sum[int64])
+	require.Len(t, failed.DataPoints, 1)
+	assert.Equal(t, int64(1), failed.DataPoints[0].Value)
+
+	duration := values["cassandra_migrate.migration.duration"].(metricdata.Histogram[float64])
+	require.Len(t, duration.DataPoints, 1)
+	assert.Equal(t, uint64(3), duration.DataPoints[0].Count)
+	assert.Equal(t, 4.0, duration.DataPoints[0].Sum)
+}
+
+func TestTelemetry_NoopWithoutProviders(t *testing.T) {
+	conf := Config{}
+	metrics, err := newMigrationMetrics(conf)
+	require.NoError(t, err)
+
+	_, span := startRunSpan(context.Background(), conf, DirectionUp)
+	assert.False(t, span.IsRecording())
+	endSpan(span, nil)
+	metrics.record(context.Background(), "bloodlab", DirectionUp, time.Second, nil)
+}
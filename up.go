@@ -2,13 +2,14 @@ package migrate
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	gocql "github.com/apache/cassandra-gocql-driver/v2"
 	"github.com/blutspende/cassandra-migrate/sqlparse"
 	"os"
 	"path/filepath"
-	"strconv"
+	"time"
 )
 
 // UpResult summarizes a single ApplyUp execution.
@@ -16,43 +17,107 @@ type UpResult struct {
 	AppliedCount        int
 	PendingCount        int
 	AppliedMigrationIDs []string
+	// Migrations holds the applied migrations in order with their durations.
+	Migrations []MigrationResult
+	// OutOfOrderMigrationIDs holds the pending migrations older than the
+	// newest applied one, see Config.OutOfOrder.
+	OutOfOrderMigrationIDs []string
+	// Repeatable holds the repeatable migrations applied after the versioned ones.
+	Repeatable []MigrationResult
+	// SkippedMigrationIDs holds the applied and recorded migrations whose Up
+	// statements are restricted to other environments with '-- +migrate Env'.
+	SkippedMigrationIDs []string
+	// Compensation reports the undone statements of the failed migration
+	// when Config.Compensate is set, nil otherwise.
+	Compensation *Compensation
+}
+
+// MigrationResult describes one applied or reverted migration.
+type MigrationResult struct {
+	ID       string
+	Duration time.Duration
 }
 
 // ApplyUp executes all pending migration Up statements and records applied IDs.
 func ApplyUp(conf Config) (UpResult, error) {
-	migrationFiles, err := filepath.Glob(filepath.Join(conf.MigrationDir, "*.cql"))
+	return ApplyUpContext(context.Background(), conf)
+}
+
+// ApplyUpContext is ApplyUp with a context for query cancellation and tracing.
+func ApplyUpContext(ctx context.Context, conf Config) (result UpResult, err error) {
+	ctx, span := startRunSpan(ctx, conf, DirectionUp)
+	defer func() { endSpan(span, err) }()
+
+	migrationFiles, err := listMigrationFiles(conf)
 	if err != nil {
 		return UpResult{}, err
 	}
-	port, err := strconv.Atoi(conf.Connection.Port)
+	metrics, err := newMigrationMetrics(conf)
 	if err != nil {
 		return UpResult{}, err
 	}
-	session, err := GetConnection(conf.Connection.Hosts, port, conf.Keyspace, conf.Connection.Username, conf.Connection.Password)
+	session, err := openSession(conf)
 	if err != nil {
 		return UpResult{}, err
 	}
 	defer session.Close()
-	err = session.Query(fmt.Sprintf(createMigrationsTableQueryTemplate, conf.Keyspace)).Exec()
+	execQuery := func(statement string, args ...any) error {
+		return session.Exec(ctx, statement, args...)
+	}
+	err = execQuery(fmt.Sprintf(createMigrationsTableQueryTemplate, conf.TrackingTable()))
 	if err != nil {
 		return UpResult{}, err
 	}
-	existingMigrationIDs, err := GetExistingMigrationIDs(conf.Keyspace, session)
+	history, err := newHistoryRecorder(conf, execQuery)
 	if err != nil {
 		return UpResult{}, err
 	}
-	if len(existingMigrationIDs) > len(migrationFiles) {
-		migrationFilenamesMap := make(map[string]any)
-		for _, file := range migrationFiles {
-			migrationFilenamesMap[filepath.Base(file)] = nil
+	repeatables, err := loadPendingRepeatables(ctx, conf, session, execQuery)
+	if err != nil {
+		return UpResult{}, err
+	}
+	existingMigrationIDs, err := existingMigrationIDs(ctx, session, conf.TrackingTable())
+	if err != nil {
+		return UpResult{}, err
+	}
+	baselines, err := readBaselines(migrationFiles)
+	if err != nil {
+		return UpResult{}, err
+	}
+	knownMigrationIDs := make(map[string]any)
+	for _, file := range migrationFiles {
+		knownMigrationIDs[filepath.Base(file)] = nil
+	}
+	for _, covers := range baselines {
+		for _, id := range covers {
+			knownMigrationIDs[id] = nil
 		}
+	}
+	if len(existingMigrationIDs) > len(migrationFiles) {
 		for id := range existingMigrationIDs {
-			if _, ok := migrationFilenamesMap[id]; !ok {
+			if _, ok := knownMigrationIDs[id]; !ok {
 				return UpResult{}, errors.New("unknown migration in database: " + id)
 			}
 		}
 	}
+	adoptable, err := adoptableBaselines(baselines, existingMigrationIDs)
+	if err != nil {
+		return UpResult{}, err
+	}
+	for _, id := range adoptable {
+		content, err := os.ReadFile(filepath.Join(conf.MigrationDir, id))
+		if err != nil {
+			return UpResult{}, err
+		}
+		if err := recordBaseline(ctx, conf, session, id, baselines[id]); err != nil {
+			return UpResult{}, fmt.Errorf("failed to record baseline %s: %w", id, err)
+		}
+		history.record(id, HistoryBaseline, checksum(content), 0, nil)
+		conf.logger().Info("recorded baseline of applied migrations", "migration", id, "covers", len(baselines[id]))
+		existingMigrationIDs[id] = nil
+	}
 	appliedMigrationIDs := make([]string, 0)
+	appliedMigrations := make([]MigrationResult, 0)
 	var execErr error
 	newMigrationFiles := make([]string, 0)
 
@@ -62,68 +127,224 @@ func ApplyUp(conf Config) (UpResult, error) {
 		}
 		newMigrationFiles = append(newMigrationFiles, file)
 	}
+	logger := conf.logger()
+	logger.Info("pending migrations", "count", len(newMigrationFiles), "applied", len(existingMigrationIDs), "repeatable", len(repeatables))
+	pendingIDs := make([]string, 0, len(newMigrationFiles))
 	for _, file := range newMigrationFiles {
+		pendingIDs = append(pendingIDs, filepath.Base(file))
+	}
+	outOfOrder := outOfOrderMigrationIDs(existingMigrationIDs, pendingIDs)
+	if err := checkOutOfOrder(conf, outOfOrder); err != nil {
+		return UpResult{PendingCount: len(newMigrationFiles), AppliedMigrationIDs: appliedMigrationIDs, OutOfOrderMigrationIDs: outOfOrder}, err
+	}
+	if err := confirmDangerousMigrations(conf, newMigrationFiles); err != nil {
+		return UpResult{PendingCount: len(newMigrationFiles), AppliedMigrationIDs: appliedMigrationIDs, OutOfOrderMigrationIDs: outOfOrder}, err
+	}
+	hooks := newHookRunner(conf, DirectionUp)
+	hasPending := len(newMigrationFiles) > 0 || len(repeatables) > 0
+	if hasPending {
+		if err := hooks.beforeRun(); err != nil {
+			return UpResult{PendingCount: len(newMigrationFiles), AppliedMigrationIDs: appliedMigrationIDs, OutOfOrderMigrationIDs: outOfOrder}, err
+		}
+	}
+	skippedMigrationIDs := make([]string, 0)
+	var compensation *Compensation
+	var failedMigrationID string
+	for _, file := range newMigrationFiles {
+		failedMigrationID = filepath.Base(file)
 		content, err := os.ReadFile(file)
 		if err != nil {
-			return UpResult{}, err
+			execErr = err
+			break
 		}
 		migration, err := sqlparse.ParseMigration(bytes.NewReader(content))
 		if err != nil {
-			return UpResult{}, err
+			execErr = err
+			break
+		}
+		skipped := skipsUp(migration, conf.Environment)
+		if skipped {
+			logger.Info("skipping migration statements for environment", "migration", failedMigrationID, "environment", conf.Environment)
+		}
+		duration, applied, err := runMigration(ctx, conf, hooks, metrics, failedMigrationID, func(ctx context.Context) error {
+			return applyAndRecordMigration(ctx, conf, file, migration.UpStatementsFor(conf.Environment), sessionExecutor(ctx, session))
+		})
+		recordHistory(history, failedMigrationID, checksum(content), duration, applied, err)
+		var statementErr *StatementError
+		if conf.Compensate && errors.As(err, &statementErr) {
+			undone := compensate(conf, failedMigrationID, migration, statementErr, execQuery)
+			history.record(failedMigrationID, HistoryCompensate, checksum(content), 0, undone.err())
+			compensation = &undone
+		}
+		if applied && skipped {
+			skippedMigrationIDs = append(skippedMigrationIDs, failedMigrationID)
+		}
+		if applied {
+			appliedMigrationIDs = append(appliedMigrationIDs, failedMigrationID)
+			appliedMigrations = append(appliedMigrations, MigrationResult{ID: failedMigrationID, Duration: duration})
 		}
-		err = applyAndRecordMigration(
-			conf.Keyspace,
-			file,
-			migration.UpStatements,
-			conf.IgnoreExistErrors,
-			func(statement string, args ...any) error {
-				return session.Query(statement, args...).Exec()
-			},
-		)
 		if err != nil {
 			execErr = err
 			break
 		}
-		appliedMigrationIDs = append(appliedMigrationIDs, filepath.Base(file))
+	}
+	appliedRepeatables := make([]MigrationResult, 0)
+	for i := 0; execErr == nil && i < len(repeatables); i++ {
+		repeatable := repeatables[i]
+		failedMigrationID = repeatable.id
+		migration, err := sqlparse.ParseMigration(bytes.NewReader(repeatable.content))
+		if err != nil {
+			execErr = err
+			break
+		}
+		skipped := skipsUp(migration, conf.Environment)
+		if skipped {
+			logger.Info("skipping migration statements for environment", "migration", repeatable.id, "environment", conf.Environment)
+		}
+		duration, applied, err := runMigration(ctx, conf, hooks, metrics, repeatable.id, func(ctx context.Context) error {
+			return applyAndRecordRepeatable(ctx, conf, repeatable, migration.UpStatementsFor(conf.Environment), sessionExecutor(ctx, session))
+		})
+		recordHistory(history, repeatable.id, repeatable.checksum, duration, applied, err)
+		if applied && skipped {
+			skippedMigrationIDs = append(skippedMigrationIDs, repeatable.id)
+		}
+		if applied {
+			appliedRepeatables = append(appliedRepeatables, MigrationResult{ID: repeatable.id, Duration: duration})
+		}
+		execErr = err
+	}
+	if execErr == nil {
+		failedMigrationID = ""
+	} else {
+		execErr = &MigrationError{MigrationID: failedMigrationID, Err: execErr}
+	}
+	if hasPending {
+		execErr = hooks.finishRun(failedMigrationID, execErr)
 	}
 
-	result := UpResult{
-		AppliedCount:        len(appliedMigrationIDs),
-		PendingCount:        len(newMigrationFiles),
-		AppliedMigrationIDs: appliedMigrationIDs,
+	result = UpResult{
+		AppliedCount:           len(appliedMigrationIDs),
+		PendingCount:           len(newMigrationFiles),
+		AppliedMigrationIDs:    appliedMigrationIDs,
+		Migrations:             appliedMigrations,
+		OutOfOrderMigrationIDs: outOfOrder,
+		Repeatable:             appliedRepeatables,
+		SkippedMigrationIDs:    skippedMigrationIDs,
+		Compensation:           compensation,
 	}
 	return result, execErr
 }
 
+// skipsUp reports whether the Up statements of migration are restricted to
+// environments other than env. Such migrations are still recorded.
+func skipsUp(migration *sqlparse.ParsedMigration, env string) bool {
+	return !sqlparse.MatchesEnv(migration.Envs, env) || !sqlparse.MatchesEnv(migration.UpEnvs, env)
+}
+
+// recordHistory records the outcome of runMigration. A failing after
+// migration hook does not make the applied migration fail.
+func recordHistory(history historyRecorder, migrationID, checksum string, duration time.Duration, applied bool, err error) {
+	if applied {
+		err = nil
+	}
+	history.record(migrationID, HistoryUp, checksum, duration, err)
+}
+
+// runMigration applies one migration between its hooks with tracing, metrics
+// and logging. It reports whether apply succeeded, which is also the case
+// when only the after migration hook fails.
+func runMigration(ctx context.Context, conf Config, hooks hookRunner, metrics migrationMetrics, migrationID string, apply func(ctx context.Context) error) (time.Duration, bool, error) {
+	if err := hooks.beforeMigration(migrationID); err != nil {
+		return 0, false, err
+	}
+	logger := conf.logger()
+	logger.Info("applying migration", "migration", migrationID, "direction", DirectionUp)
+	migrationCtx, migrationSpan := startMigrationSpan(ctx, conf, migrationID, DirectionUp)
+	start := time.Now()
+	err := apply(migrationCtx)
+	duration := time.Since(start)
+	metrics.record(ctx, conf.Keyspace, DirectionUp, duration, err)
+	endSpan(migrationSpan, err)
+	if err != nil {
+		return duration, false, err
+	}
+	logger.Info("applied migration", "migration", migrationID, "direction", DirectionUp, "duration", duration)
+
+	return duration, true, hooks.afterMigration(migrationID)
+}
+
 const (
-	createMigrationsTableQueryTemplate = `CREATE TABLE IF NOT EXISTS "%s_migrations" (id TEXT, applied_at TIMESTAMP, PRIMARY KEY(id));`
-	insertMigrationQueryTemplate       = `INSERT INTO "%s_migrations" (id, applied_at) VALUES (?, toTimestamp(now()));`
+	createMigrationsTableQueryTemplate = `CREATE TABLE IF NOT EXISTS %s (id TEXT, applied_at TIMESTAMP, PRIMARY KEY(id));`
+	insertMigrationQueryTemplate       = `INSERT INTO %s (id, applied_at) VALUES (?, toTimestamp(now()));`
+	insertMigrationAtQueryTemplate     = `INSERT INTO %s (id, applied_at) VALUES (?, ?);`
 )
 
 type queryExecutor func(statement string, args ...any) error
 
-func applyAndRecordMigration(keyspace, file string, statements []string, ignoreExistErrors bool, execQuery queryExecutor) error {
+// sessionExecutor returns a queryExecutor running statements on session with
+// ctx, so they belong to the span in ctx.
+func sessionExecutor(ctx context.Context, session Session) queryExecutor {
+	return func(statement string, args ...any) error {
+		return session.Exec(ctx, statement, args...)
+	}
+}
+
+func applyAndRecordMigration(ctx context.Context, conf Config, file string, statements []string, execQuery queryExecutor) error {
 	migrationID := filepath.Base(file)
-	for _, statement := range statements {
+	if err := executeStatements(ctx, conf, migrationID, DirectionUp, statements, execQuery); err != nil {
+		return fmt.Errorf("failed to execute statement in %s: %w", migrationID, err)
+	}
+
+	if err := execQuery(fmt.Sprintf(insertMigrationQueryTemplate, conf.TrackingTable()), migrationID); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", migrationID, err)
+	}
+
+	return nil
+}
+
+// executeStatements runs the statements of one migration in order, skipping
+// "already exists" errors when conf.IgnoreExistErrors is set.
+func executeStatements(ctx context.Context, conf Config, migrationID string, direction Direction, statements []string, execQuery queryExecutor) error {
+	logger := conf.logger().With("migration", migrationID, "direction", direction)
+	applied := make([]int, 0, len(statements))
+	for i, statement := range statements {
+		_, span := startStatementSpan(ctx, conf, migrationID, i, statement)
+		start := time.Now()
 		err := execQuery(statement)
+		duration := time.Since(start)
 		if err != nil {
-			if ignoreExistErrors && IsExistError(err) {
+			if conf.IgnoreExistErrors && IsExistError(err) {
+				logger.Warn("ignored already exists error", "statement_index", i, "statement", statement, "error", err)
+				span.AddEvent("ignored already exists error")
+				endSpan(span, nil)
 				continue
 			}
-			return fmt.Errorf("failed to execute statement in %s: %w", migrationID, err)
+			logger.Error("statement failed", "statement_index", i, "statement", statement, "duration", duration, "error", err)
+			endSpan(span, err)
+			return &StatementError{Index: i, Statement: statement, Err: err, Applied: applied}
 		}
-	}
-
-	if err := execQuery(fmt.Sprintf(insertMigrationQueryTemplate, keyspace), migrationID); err != nil {
-		return fmt.Errorf("failed to record migration %s: %w", migrationID, err)
+		applied = append(applied, i)
+		endSpan(span, nil)
+		logger.Debug("executed statement", "statement_index", i, "statement", statement, "duration", duration)
 	}
 
 	return nil
 }
 
-// GetExistingMigrationIDs returns applied migration IDs as a set.
+// GetExistingMigrationIDs returns applied migration IDs of a keyspace that
+// uses the default tracking table as a set.
 func GetExistingMigrationIDs(keyspace string, session *gocql.Session) (map[string]any, error) {
-	existingMigrations, err := GetExistingMigrations(keyspace, session)
+	return GetExistingMigrationIDsInTable(Config{Keyspace: keyspace}.TrackingTable(), session)
+}
+
+// GetExistingMigrationIDsInTable returns the migration IDs recorded in the
+// given tracking table as a set.
+func GetExistingMigrationIDsInTable(table string, session *gocql.Session) (map[string]any, error) {
+	return existingMigrationIDs(context.Background(), NewSession(session), table)
+}
+
+func existingMigrationIDs(ctx context.Context, session Session, table string) (map[string]any, error) {
+	existingMigrations, err := existingMigrations(ctx, session, table)
 	if err != nil {
 		return nil, err
 	}
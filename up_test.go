@@ -1,8 +1,12 @@
 package migrate
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"path/filepath"
 	"testing"
 
@@ -60,27 +64,38 @@ func TestApplyUp_InvalidPort(t *testing.T) {
 }
 
 func TestCreateMigrationsTableQueryTemplate(t *testing.T) {
-	query := fmt.Sprintf(createMigrationsTableQueryTemplate, "bloodlab")
+	query := fmt.Sprintf(createMigrationsTableQueryTemplate, Config{Keyspace: "bloodlab"}.TrackingTable())
 
 	assert.Equal(t, `CREATE TABLE IF NOT EXISTS "bloodlab_migrations" (id TEXT, applied_at TIMESTAMP, PRIMARY KEY(id));`, query)
 }
 
 func TestInsertMigrationQueryTemplate(t *testing.T) {
-	query := fmt.Sprintf(insertMigrationQueryTemplate, "bloodlab")
+	query := fmt.Sprintf(insertMigrationQueryTemplate, Config{Keyspace: "bloodlab"}.TrackingTable())
 
 	assert.Equal(t, `INSERT INTO "bloodlab_migrations" (id, applied_at) VALUES (?, toTimestamp(now()));`, query)
 }
 
+func TestInsertMigrationQueryTemplate_CustomTrackingTable(t *testing.T) {
+	conf := Config{
+		Keyspace:          "bloodlab",
+		MigrationTable:    "schema_history",
+		MigrationKeyspace: "migrations",
+	}
+	query := fmt.Sprintf(insertMigrationQueryTemplate, conf.TrackingTable())
+
+	assert.Equal(t, `INSERT INTO "migrations"."schema_history" (id, applied_at) VALUES (?, toTimestamp(now()));`, query)
+}
+
 func TestApplyAndRecordMigration_RecordsImmediatelyAfterFileStatements(t *testing.T) {
 	calls := make([]queryCall, 0)
 	err := applyAndRecordMigration(
-		"bloodlab",
+		context.Background(),
+		Config{Keyspace: "bloodlab"},
 		filepath.Join("migrations", "20260422123000-create-users.cql"),
 		[]string{
 			"CREATE TABLE users (id uuid PRIMARY KEY);",
 			"CREATE INDEX users_id_idx ON users (id);",
 		},
-		false,
 		func(statement string, args ...any) error {
 			calls = append(calls, queryCall{statement: statement, args: args})
 			return nil
@@ -93,7 +108,7 @@ func TestApplyAndRecordMigration_RecordsImmediatelyAfterFileStatements(t *testin
 	assert.Empty(t, calls[0].args)
 	assert.Equal(t, "CREATE INDEX users_id_idx ON users (id);", calls[1].statement)
 	assert.Empty(t, calls[1].args)
-	assert.Equal(t, fmt.Sprintf(insertMigrationQueryTemplate, "bloodlab"), calls[2].statement)
+	assert.Equal(t, fmt.Sprintf(insertMigrationQueryTemplate, `"bloodlab_migrations"`), calls[2].statement)
 	assert.Equal(t, []any{"20260422123000-create-users.cql"}, calls[2].args)
 }
 
@@ -101,13 +116,13 @@ func TestApplyAndRecordMigration_DoesNotRecordWhenStatementFails(t *testing.T) {
 	expectedErr := errors.New("statement failed")
 	calls := make([]queryCall, 0)
 	err := applyAndRecordMigration(
-		"bloodlab",
+		context.Background(),
+		Config{Keyspace: "bloodlab"},
 		filepath.Join("migrations", "20260422123000-create-users.cql"),
 		[]string{
 			"CREATE TABLE users (id uuid PRIMARY KEY);",
 			"CREATE INDEX users_id_idx ON users (id);",
 		},
-		false,
 		func(statement string, args ...any) error {
 			calls = append(calls, queryCall{statement: statement, args: args})
 			if statement == "CREATE INDEX users_id_idx ON users (id);" {
@@ -119,6 +134,10 @@ func TestApplyAndRecordMigration_DoesNotRecordWhenStatementFails(t *testing.T) {
 	require.Error(t, err)
 	assert.ErrorIs(t, err, expectedErr)
 	assert.Equal(t, "failed to execute statement in 20260422123000-create-users.cql: statement failed", err.Error())
+	var statementErr *StatementError
+	require.ErrorAs(t, err, &statementErr)
+	assert.Equal(t, 1, statementErr.Index)
+	assert.Equal(t, "CREATE INDEX users_id_idx ON users (id);", statementErr.Statement)
 
 	require.Len(t, calls, 2)
 	assert.Equal(t, "CREATE TABLE users (id uuid PRIMARY KEY);", calls[0].statement)
@@ -128,12 +147,12 @@ func TestApplyAndRecordMigration_DoesNotRecordWhenStatementFails(t *testing.T) {
 func TestApplyAndRecordMigration_IgnoresAlreadyExistsAndStillRecords(t *testing.T) {
 	calls := make([]queryCall, 0)
 	err := applyAndRecordMigration(
-		"bloodlab",
+		context.Background(),
+		Config{Keyspace: "bloodlab", IgnoreExistErrors: true},
 		filepath.Join("migrations", "20260422123000-create-users.cql"),
 		[]string{
 			"CREATE TABLE users (id uuid PRIMARY KEY);",
 		},
-		true,
 		func(statement string, args ...any) error {
 			calls = append(calls, queryCall{statement: statement, args: args})
 			if statement == "CREATE TABLE users (id uuid PRIMARY KEY);" {
@@ -149,6 +168,50 @@ func TestApplyAndRecordMigration_IgnoresAlreadyExistsAndStillRecords(t *testing.
 
 	require.Len(t, calls, 2)
 	assert.Equal(t, "CREATE TABLE users (id uuid PRIMARY KEY);", calls[0].statement)
-	assert.Equal(t, fmt.Sprintf(insertMigrationQueryTemplate, "bloodlab"), calls[1].statement)
+	assert.Equal(t, fmt.Sprintf(insertMigrationQueryTemplate, `"bloodlab_migrations"`), calls[1].statement)
 	assert.Equal(t, []any{"20260422123000-create-users.cql"}, calls[1].args)
 }
+
+func TestApplyAndRecordMigration_LogsStatementsAndIgnoredErrors(t *testing.T) {
+	var logs bytes.Buffer
+	conf := Config{
+		Keyspace:          "bloodlab",
+		IgnoreExistErrors: true,
+		Logger:            slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+	err := applyAndRecordMigration(
+		context.Background(),
+		conf,
+		filepath.Join("migrations", "20260422123000-create-users.cql"),
+		[]string{
+			"CREATE TABLE users (id uuid PRIMARY KEY);",
+			"CREATE INDEX users_id_idx ON users (id);",
+		},
+		func(statement string, args ...any) error {
+			if statement == "CREATE TABLE users (id uuid PRIMARY KEY);" {
+				return requestErrorStub{code: gocql.ErrCodeAlreadyExists, message: "table already exists"}
+			}
+			return nil
+		},
+	)
+	require.NoError(t, err)
+
+	records := make([]map[string]any, 0)
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		var record map[string]any
+		require.NoError(t, decoder.Decode(&record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 2)
+	assert.Equal(t, "ignored already exists error", records[0]["msg"])
+	assert.Equal(t, "WARN", records[0]["level"])
+	assert.Equal(t, "20260422123000-create-users.cql", records[0]["migration"])
+	assert.Equal(t, "up", records[0]["direction"])
+	assert.Equal(t, float64(0), records[0]["statement_index"])
+	assert.Equal(t, "table already exists", records[0]["error"])
+	assert.Equal(t, "executed statement", records[1]["msg"])
+	assert.Equal(t, "DEBUG", records[1]["level"])
+	assert.Equal(t, float64(1), records[1]["statement_index"])
+	assert.Contains(t, records[1], "duration")
+}
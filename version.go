@@ -0,0 +1,128 @@
+package migrate
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// VersioningTimestamp prefixes new migrations with a local 14 digit timestamp.
+	VersioningTimestamp = "timestamp"
+	// VersioningUTC prefixes new migrations with a 14 digit UTC timestamp.
+	VersioningUTC = "utc"
+	// VersioningSequential prefixes new migrations with the next free zero
+	// padded number, e.g. 0001.
+	VersioningSequential = "sequential"
+
+	DefaultVersioning = VersioningTimestamp
+
+	sequentialVersionWidth = 4
+	timestampVersionFormat = "20060102150405"
+)
+
+// MigrationVersion returns the numeric version prefix of a migration ID, e.g.
+// 20260306130542 for 20260306130542-create-users.cql and 2 for 0002-add-index.cql.
+func MigrationVersion(id string) (uint64, error) {
+	prefix, _, ok := strings.Cut(id, "-")
+	if !ok || prefix == "" {
+		return 0, fmt.Errorf("migration %s has no version prefix", id)
+	}
+	version, err := strconv.ParseUint(prefix, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("migration %s has no version prefix", id)
+	}
+
+	return version, nil
+}
+
+// CompareMigrationIDs orders migration IDs by numeric version, then by name,
+// as ApplyUp applies them. Timestamp and sequential versions are both plain
+// numbers, so this also orders directories that switched between the schemes.
+// It can be passed to slices.SortFunc.
+func CompareMigrationIDs(left, right string) int {
+	leftVersion, leftErr := MigrationVersion(left)
+	rightVersion, rightErr := MigrationVersion(right)
+	if leftErr == nil && rightErr == nil && leftVersion != rightVersion {
+		return cmp.Compare(leftVersion, rightVersion)
+	}
+
+	return strings.Compare(left, right)
+}
+
+// listMigrationFiles returns the versioned migration files of
+// conf.MigrationDir in version order, leaving out repeatable migrations.
+// With VersioningSequential every file must have a unique version prefix.
+// Otherwise files without one or with a duplicate version are logged and
+// kept, ordered by name like before version ordering existed.
+func listMigrationFiles(conf Config) ([]string, error) {
+	migrationFiles, err := filepath.Glob(filepath.Join(conf.MigrationDir, "*.cql"))
+	if err != nil {
+		return nil, err
+	}
+	migrationFiles = slices.DeleteFunc(migrationFiles, func(file string) bool {
+		return IsRepeatableMigration(filepath.Base(file))
+	})
+	strict := conf.Versioning == VersioningSequential
+	versions := make(map[uint64]string, len(migrationFiles))
+	for _, file := range migrationFiles {
+		id := filepath.Base(file)
+		version, err := MigrationVersion(id)
+		if err == nil {
+			if other, ok := versions[version]; ok {
+				err = fmt.Errorf("migrations %s and %s have the same version", other, id)
+			}
+			versions[version] = id
+		}
+		if err != nil && strict {
+			return nil, err
+		}
+		if err != nil {
+			conf.logger().Warn("migration is not versioned consistently", "migration", id, "error", err)
+		}
+	}
+	slices.SortFunc(migrationFiles, func(left, right string) int {
+		return CompareMigrationIDs(filepath.Base(left), filepath.Base(right))
+	})
+
+	return migrationFiles, nil
+}
+
+// nextSequentialVersion returns one more than the highest version in dir. It
+// refuses directories with timestamp versions, as a sequential version would
+// either sort before them or continue their 14 digit numbers.
+func nextSequentialVersion(dir string) (uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var highest uint64
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".cql" {
+			continue
+		}
+		version, err := MigrationVersion(entry.Name())
+		if err != nil {
+			continue
+		}
+		if prefix, _, _ := strings.Cut(entry.Name(), "-"); len(prefix) == len(timestampVersionFormat) {
+			return 0, fmt.Errorf("migration %s has a timestamp version, sequential versioning cannot continue it", entry.Name())
+		}
+		highest = max(highest, version)
+	}
+
+	return highest + 1, nil
+}
+
+func validateVersioning(versioning string) error {
+	switch versioning {
+	case VersioningTimestamp, VersioningUTC, VersioningSequential:
+		return nil
+	default:
+		return fmt.Errorf("invalid versioning %q: must be timestamp, utc or sequential", versioning)
+	}
+}
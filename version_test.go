@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationVersion(t *testing.T) {
+	version, err := MigrationVersion("20260306130542-create-users.cql")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20260306130542), version)
+
+	version, err = MigrationVersion("0002-add-index.cql")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), version)
+
+	_, err = MigrationVersion("create-users.cql")
+	require.Error(t, err)
+	assert.Equal(t, "migration create-users.cql has no version prefix", err.Error())
+}
+
+func TestCompareMigrationIDs(t *testing.T) {
+	assert.Negative(t, CompareMigrationIDs("0002-add-index.cql", "0010-add-email.cql"))
+	assert.Negative(t, CompareMigrationIDs("9999-add-index.cql", "10000-add-email.cql"))
+	assert.Negative(t, CompareMigrationIDs("0003-add-index.cql", "20260306130542-create-users.cql"))
+	assert.Positive(t, CompareMigrationIDs("20260306130543-add-email.cql", "20260306130542-create-users.cql"))
+	assert.Zero(t, CompareMigrationIDs("0001-create-users.cql", "0001-create-users.cql"))
+}
+
+func TestListMigrationFiles_SortsByVersion(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"10000-add-email.cql", "0002-add-index.cql", "9999-add-column.cql"} {
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, name), nil, 0o644))
+	}
+
+	files, err := listMigrationFiles(Config{MigrationDir: tempDir})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		filepath.Join(tempDir, "0002-add-index.cql"),
+		filepath.Join(tempDir, "9999-add-column.cql"),
+		filepath.Join(tempDir, "10000-add-email.cql"),
+	}, files)
+}
+
+func TestListMigrationFiles_RejectsDuplicateVersions(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"0002-add-index.cql", "0002-add-email.cql"} {
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, name), nil, 0o644))
+	}
+
+	_, err := listMigrationFiles(Config{MigrationDir: tempDir, Versioning: VersioningSequential})
+	require.Error(t, err)
+	assert.Equal(t, "migrations 0002-add-email.cql and 0002-add-index.cql have the same version", err.Error())
+}
+
+func TestListMigrationFiles_RejectsMissingVersion(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "create-users.cql"), nil, 0o644))
+
+	_, err := listMigrationFiles(Config{MigrationDir: tempDir, Versioning: VersioningSequential})
+	require.Error(t, err)
+	assert.Equal(t, "migration create-users.cql has no version prefix", err.Error())
+}
+
+func TestListMigrationFiles_WarnsWithoutSequentialVersioning(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"0002-add-index.cql", "0002-add-email.cql", "create-users.cql"} {
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, name), nil, 0o644))
+	}
+	var logs bytes.Buffer
+
+	files, err := listMigrationFiles(Config{MigrationDir: tempDir, Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		filepath.Join(tempDir, "0002-add-email.cql"),
+		filepath.Join(tempDir, "0002-add-index.cql"),
+		filepath.Join(tempDir, "create-users.cql"),
+	}, files)
+	assert.Contains(t, logs.String(), "migrations 0002-add-email.cql and 0002-add-index.cql have the same version")
+	assert.Contains(t, logs.String(), "migration create-users.cql has no version prefix")
+}